@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"cas-gateway/middleware"
+	"cas-gateway/models"
+)
+
+// maintenanceStatus 维护模式状态（管理端点返回）
+type maintenanceStatus struct {
+	Route   string `json:"route"`
+	Enabled bool   `json:"enabled"`
+	Source  string `json:"source,omitempty"` // admin、flag_file 或 config
+}
+
+// newAdminHandler 创建管理端点处理器，current 返回当前生效的配置
+//
+//	GET    /maintenance                            查看维护状态
+//	POST   /maintenance?route=<名称>&enabled=true   开启或关闭维护（优先于配置和标记文件）
+//	DELETE /maintenance?route=<名称>                清除管理端点的设置
+func newAdminHandler(cfg models.AdminConfig, state *middleware.MaintenanceState, current func() *models.Config) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/maintenance", func(w http.ResponseWriter, r *http.Request) {
+		route := &current().Route
+		if name := r.URL.Query().Get("route"); name != "" && name != route.Name {
+			http.Error(w, "路由不存在: "+name, http.StatusNotFound)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			enabled, err := strconv.ParseBool(r.URL.Query().Get("enabled"))
+			if err != nil {
+				http.Error(w, "enabled 参数无效，应为 true 或 false", http.StatusBadRequest)
+				return
+			}
+			state.Set(route.Name, enabled)
+			slog.Info("管理端点设置维护模式", "route", route.Name, "enabled", enabled, "remote_addr", r.RemoteAddr)
+		case http.MethodDelete:
+			state.Clear(route.Name)
+			slog.Info("管理端点清除维护模式设置", "route", route.Name, "remote_addr", r.RemoteAddr)
+		default:
+			w.Header().Set("Allow", "GET, POST, DELETE")
+			http.Error(w, "方法不允许", http.StatusMethodNotAllowed)
+			return
+		}
+
+		enabled, source := state.Enabled(route)
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(maintenanceStatus{Route: route.Name, Enabled: enabled, Source: source})
+	})
+
+	if cfg.Token == "" {
+		return mux
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(cfg.Token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="cas-gateway-admin"`)
+			http.Error(w, "未授权", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
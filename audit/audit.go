@@ -0,0 +1,187 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+	"cas-gateway/models"
+)
+
+// 审计事件类型
+const (
+	EventLoginSuccess     = "login_success"
+	EventValidationFailed = "validation_failure"
+	EventLogout           = "logout"
+	EventSessionExpired   = "session_expired"
+	EventAccessDenied     = "access_denied"
+)
+
+// ticketPrefixLen 审计日志只记录ticket前缀，避免泄露完整ticket
+const ticketPrefixLen = 12
+
+// Event 审计事件，每个事件写为一行JSON
+type Event struct {
+	Time         time.Time `json:"time"`
+	Type         string    `json:"event"`
+	RequestID    string    `json:"request_id,omitempty"`
+	Oaid         string    `json:"oaid,omitempty"`
+	ClientIP     string    `json:"client_ip"`
+	UserAgent    string    `json:"user_agent"`
+	Route        string    `json:"route,omitempty"`
+	TicketPrefix string    `json:"ticket_prefix,omitempty"`
+	Code         string    `json:"code,omitempty"`   // CAS错误码
+	Reason       string    `json:"reason,omitempty"` // 失败或拒绝原因
+
+	// 哈希链：hash = sha256(prev_hash + 本行不含hash字段的JSON)，任意一行被修改或删除都会导致后续校验失败
+	PrevHash string `json:"prev_hash,omitempty"`
+	Hash     string `json:"hash,omitempty"`
+}
+
+// TicketPrefix 截取ticket前缀
+func TicketPrefix(ticket string) string {
+	if len(ticket) <= ticketPrefixLen {
+		return ticket
+	}
+	return ticket[:ticketPrefixLen] + "..."
+}
+
+// Logger 审计日志，只追加写入独立的JSONL文件；nil 表示未启用，所有方法均可安全调用
+type Logger struct {
+	mu        sync.Mutex
+	file      *os.File
+	hashChain bool
+	lastHash  string
+}
+
+// Open 打开审计日志文件，启用哈希链时从文件最后一行恢复链尾哈希
+func Open(cfg models.AuditConfig) (*Logger, error) {
+	l := &Logger{hashChain: cfg.HashChain}
+	if cfg.HashChain {
+		last, err := lastHash(cfg.Path)
+		if err != nil {
+			return nil, err
+		}
+		l.lastHash = last
+	}
+
+	f, err := os.OpenFile(cfg.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("打开审计日志失败: %w", err)
+	}
+	l.file = f
+	return l, nil
+}
+
+// Log 写入一条审计事件
+func (l *Logger) Log(e Event) {
+	if l == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.hashChain {
+		e.PrevHash = l.lastHash
+		e.Hash = ""
+		e.Hash = computeHash(e)
+		l.lastHash = e.Hash
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		slog.Error("序列化审计事件失败", "event", e.Type, "error", err)
+		return
+	}
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		slog.Error("写入审计日志失败", "event", e.Type, "error", err)
+	}
+}
+
+// Close 关闭审计日志
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// computeHash 计算事件哈希（e.Hash 必须为空）
+func computeHash(e Event) string {
+	data, _ := json.Marshal(e)
+	sum := sha256.Sum256(append([]byte(e.PrevHash), data...))
+	return hex.EncodeToString(sum[:])
+}
+
+// lastHash 读取文件最后一行的哈希，文件不存在时返回空
+func lastHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("读取审计日志失败: %w", err)
+	}
+	defer f.Close()
+
+	var last []byte
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+			last = append(last[:0], line...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("读取审计日志失败: %w", err)
+	}
+	if last == nil {
+		return "", nil
+	}
+	var e Event
+	if err := json.Unmarshal(last, &e); err != nil {
+		return "", fmt.Errorf("解析审计日志最后一行失败: %w", err)
+	}
+	return e.Hash, nil
+}
+
+// Verify 校验审计日志哈希链，返回第一处不一致的行号
+func Verify(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	prev := ""
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal(line, &e); err != nil {
+			return fmt.Errorf("第 %d 行解析失败: %w", lineNo, err)
+		}
+		if e.PrevHash != prev {
+			return fmt.Errorf("第 %d 行 prev_hash 不匹配，日志可能被删除或篡改", lineNo)
+		}
+		hash := e.Hash
+		e.Hash = ""
+		if computeHash(e) != hash {
+			return fmt.Errorf("第 %d 行哈希校验失败，日志可能被篡改", lineNo)
+		}
+		prev = hash
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,103 @@
+package audit
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"cas-gateway/models"
+)
+
+// writeChain 写入 n 条启用哈希链的审计事件，返回日志文件路径
+func writeChain(t *testing.T, n int) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(models.AuditConfig{Path: path, HashChain: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		l.Log(Event{Type: EventLoginSuccess, Oaid: "alice", ClientIP: "192.0.2.1"})
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+}
+
+func TestHashChainContinuesAfterReopen(t *testing.T) {
+	path := writeChain(t, 2)
+
+	// 重新打开后从最后一行恢复链尾哈希
+	l, err := Open(models.AuditConfig{Path: path, HashChain: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Log(Event{Type: EventLogout, Oaid: "alice"})
+	l.Close()
+
+	lines := readLines(t, path)
+	if len(lines) != 3 {
+		t.Fatalf("行数 = %d，期望 3", len(lines))
+	}
+	if !strings.Contains(lines[0], `"hash":`) || strings.Contains(lines[0], `"prev_hash":`) {
+		t.Errorf("第一行应只有 hash: %s", lines[0])
+	}
+	f, _ := os.Open(path)
+	defer f.Close()
+	if err := Verify(f); err != nil {
+		t.Fatalf("校验失败: %v", err)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(lines []string) []string
+		want   string
+	}{
+		{"修改字段", func(lines []string) []string {
+			lines[1] = strings.Replace(lines[1], `"oaid":"alice"`, `"oaid":"mallory"`, 1)
+			return lines
+		}, "第 2 行哈希校验失败"},
+		{"删除中间行", func(lines []string) []string {
+			return append(lines[:1], lines[2:]...)
+		}, "第 2 行 prev_hash 不匹配"},
+		{"删除第一行", func(lines []string) []string {
+			return lines[1:]
+		}, "第 1 行 prev_hash 不匹配"},
+		{"调换顺序", func(lines []string) []string {
+			lines[1], lines[2] = lines[2], lines[1]
+			return lines
+		}, "第 2 行 prev_hash 不匹配"},
+		{"格式错误", func(lines []string) []string {
+			lines[2] = "{"
+			return lines
+		}, "第 3 行解析失败"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := tt.modify(readLines(t, writeChain(t, 3)))
+			err := Verify(strings.NewReader(strings.Join(lines, "\n") + "\n"))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("错误 = %v，期望包含 %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyEmpty(t *testing.T) {
+	if err := Verify(bytes.NewReader(nil)); err != nil {
+		t.Fatalf("空日志校验失败: %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+package cas
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+	"cas-gateway/metrics"
+)
+
+// 熔断器状态，取值与 cas_gateway_cas_circuit_state 指标一致
+type breakerState int
+
+const (
+	stateClosed breakerState = iota
+	stateOpen
+	stateHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case stateOpen:
+		return "open"
+	case stateHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// breaker CAS熔断器：连续失败达到阈值后打开，打开期间不再请求CAS；
+// 超过打开时长后进入半开状态，只放行一个试探请求，成功则关闭，失败则重新打开。nil 表示不启用熔断
+type breaker struct {
+	threshold    int
+	openDuration time.Duration
+
+	mu         sync.Mutex
+	state      breakerState
+	failures   int
+	openedAt   time.Time
+	trialAt    time.Time // 半开状态下试探请求的开始时间
+	trialAlive bool      // 半开状态下是否有试探请求尚未返回结果
+}
+
+func newBreaker(threshold int, openDuration time.Duration) *breaker {
+	metrics.CASCircuitState.Set(float64(stateClosed))
+	return &breaker{threshold: threshold, openDuration: openDuration}
+}
+
+// allow 判断是否允许请求CAS，调用方放行后必须调用 success、failure 或 release；不允许时返回建议的等待时间
+// 半开状态只放行一个试探请求，其余请求在试探结果返回前被拒绝；试探请求超过打开时长仍未返回时允许新的试探
+func (b *breaker) allow() (bool, time.Duration) {
+	if b == nil {
+		return true, 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case stateOpen:
+		if remaining := b.openDuration - time.Since(b.openedAt); remaining > 0 {
+			return false, remaining
+		}
+		b.setState(stateHalfOpen)
+	case stateHalfOpen:
+		if b.trialAlive {
+			if remaining := b.openDuration - time.Since(b.trialAt); remaining > 0 {
+				return false, remaining
+			}
+		}
+	default:
+		return true, 0
+	}
+	b.trialAlive = true
+	b.trialAt = time.Now()
+	return true, 0
+}
+
+// available 返回是否可以引导用户跳转CAS登录，不改变状态：打开时长已过（可以试探）即视为可用
+func (b *breaker) available() (bool, time.Duration) {
+	if b == nil {
+		return true, 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == stateOpen {
+		if remaining := b.openDuration - time.Since(b.openedAt); remaining > 0 {
+			return false, remaining
+		}
+	}
+	return true, 0
+}
+
+// success 记录一次成功（CAS有响应，包括 ticket 无效等业务错误）
+func (b *breaker) success() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.trialAlive = false
+	if b.state != stateClosed {
+		b.setState(stateClosed)
+	}
+}
+
+// release 放弃一次没有结果的请求（如客户端断开），不改变失败计数和状态；半开状态下允许新的试探
+func (b *breaker) release() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trialAlive = false
+}
+
+// failure 记录一次失败（网络错误、超时、5xx）
+func (b *breaker) failure() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.trialAlive = false
+	if b.state == stateHalfOpen || (b.state == stateClosed && b.failures >= b.threshold) {
+		b.openedAt = time.Now()
+		b.setState(stateOpen)
+	}
+}
+
+// setState 切换状态并记录日志，调用方需持有锁
+func (b *breaker) setState(s breakerState) {
+	if s == stateOpen {
+		slog.Error("CAS熔断器打开，暂停跳转登录和ticket验证", "failures", b.failures, "open_duration", b.openDuration.String())
+	} else {
+		slog.Warn("CAS熔断器状态变更", "from", b.state.String(), "to", s.String())
+	}
+	b.state = s
+	metrics.CASCircuitState.Set(float64(s))
+}
@@ -1,57 +1,116 @@
 ﻿package cas
 
 import (
+	"context"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"time"
 	"cas-gateway/auth"
-	"cas-gateway/config"
+	"cas-gateway/metrics"
+	"cas-gateway/models"
+	"cas-gateway/reqinfo"
+	"cas-gateway/tracing"
 )
 
 // CASProvider CAS认证提供者
 type CASProvider struct {
 	baseURL      string
 	loginPath    string
+	logoutPath   string
 	validatePath string
 	useJSON      bool
+	client       *casClient
+
+	breaker       *breaker
+	probeInterval time.Duration
+	lastProbe     atomic.Int64 // 上次探测时间（UnixNano）
+	probing       atomic.Bool
 }
 
 // NewCASProvider 创建CAS认证提供者
-func NewCASProvider() (*CASProvider, error) {
-	cfg := config.AppConfig
+func NewCASProvider(cfg *models.CASConfig) (*CASProvider, error) {
 	if cfg == nil {
 		return nil, fmt.Errorf("配置未加载")
 	}
 
-	validatePath := cfg.CAS.ValidatePath
+	validatePath := cfg.ValidatePath
 	if validatePath == "" {
 		validatePath = "/p3/serviceValidate" // 默认值
 	}
 
-	loginPath := cfg.CAS.LoginPath
+	loginPath := cfg.LoginPath
 	if loginPath == "" {
 		loginPath = "/login" // 默认值
 	}
 
-	return &CASProvider{
-		baseURL:      cfg.CAS.BaseURL,
-		loginPath:    loginPath,
-		validatePath: validatePath,
-		useJSON:      cfg.CAS.UseJSON,
-	}, nil
+	logoutPath := cfg.LogoutPath
+	if logoutPath == "" {
+		logoutPath = "/cas2/logout" // 默认值
+	}
+
+	client, err := newCASClient(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("CAS TLS配置无效: %w", err)
+	}
+
+	p := &CASProvider{
+		baseURL:       cfg.BaseURL,
+		loginPath:     loginPath,
+		logoutPath:    logoutPath,
+		validatePath:  validatePath,
+		useJSON:       cfg.UseJSON,
+		client:        client,
+		probeInterval: orDefault(cfg.HealthCheckInterval, defaultHealthCheckInterval),
+	}
+	if cfg.BreakerThreshold >= 0 {
+		threshold := cfg.BreakerThreshold
+		if threshold == 0 {
+			threshold = defaultBreakerThreshold
+		}
+		p.breaker = newBreaker(threshold, orDefault(cfg.BreakerOpenDuration, defaultBreakerOpenDuration))
+	}
+	return p, nil
 }
 
 // GetLoginURL 获取CAS登录URL
-func (p *CASProvider) GetLoginURL(serviceURL string) string {
+func (p *CASProvider) GetLoginURL(serviceURL string, opts auth.LoginOptions) string {
 	loginURL := p.baseURL + p.loginPath
 	u, err := url.Parse(loginURL)
 	if err != nil {
 		return loginURL
 	}
 
+	q := u.Query()
+	q.Set("service", serviceURL)
+	if opts.Renew {
+		q.Set("renew", "true")
+	} else if opts.Gateway {
+		// CAS协议规定 renew 与 gateway 同时出现时忽略 gateway
+		q.Set("gateway", "true")
+	}
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
+
+// GetLogoutURL 获取CAS登出URL，service 参数经过URL编码
+func (p *CASProvider) GetLogoutURL(serviceURL string) string {
+	logoutURL := p.baseURL + p.logoutPath
+	if serviceURL == "" {
+		return logoutURL
+	}
+	u, err := url.Parse(logoutURL)
+	if err != nil {
+		return logoutURL
+	}
+
 	q := u.Query()
 	q.Set("service", serviceURL)
 	u.RawQuery = q.Encode()
@@ -60,18 +119,103 @@ func (p *CASProvider) GetLoginURL(serviceURL string) string {
 }
 
 // ValidateTicket 验证 CAS ticket，返回用户信息（优先使用oaid）
-func (p *CASProvider) ValidateTicket(ticket, serviceURL string) (*auth.UserInfo, error) {
+func (p *CASProvider) ValidateTicket(ctx context.Context, ticket, serviceURL string, opts auth.LoginOptions) (*auth.UserInfo, error) {
+	ctx, span := tracing.Start(ctx, "cas.validate_ticket", tracing.SpanKindClient)
+	defer span.End()
+	span.SetAttr("cas.renew", opts.Renew)
+
+	// 熔断期间不请求CAS，避免每次验证都等待超时
+	if ok, _ := p.breaker.allow(); !ok {
+		metrics.TicketValidations.Inc("failure")
+		metrics.TicketValidationFailures.Inc("CIRCUIT_OPEN")
+		span.SetError(auth.ErrUnavailable)
+		return nil, auth.ErrUnavailable
+	}
+
+	start := time.Now()
+	userInfo, responded, err := p.validateTicket(ctx, ticket, serviceURL, opts)
+	metrics.TicketValidationDuration.Observe(time.Since(start).Seconds())
+	switch {
+	case responded:
+		// CAS给出了结果（包括 ticket 无效等业务错误）
+		p.breaker.success()
+	case ctx.Err() == nil && !errors.Is(err, context.Canceled) && casUnavailable(err):
+		p.breaker.failure()
+	default:
+		// 客户端断开等原因取消了请求，或请求没有发出，无法判断CAS是否可用
+		p.breaker.release()
+	}
+	if err != nil {
+		code := failureCode(err)
+		metrics.TicketValidations.Inc("failure")
+		metrics.TicketValidationFailures.Inc(code)
+		span.SetAttr("cas.error_code", code)
+		span.SetError(err)
+		return nil, err
+	}
+	metrics.TicketValidations.Inc("success")
+	span.SetAttr("enduser.id", userInfo.Oaid)
+	return userInfo, nil
+}
+
+// Available 返回是否可以跳转CAS登录（熔断器不在打开时长内）；距上次探测超过 health_check_interval 时在后台探测CAS登录页，
+// 由登录跳转触发探测，CAS不可用时即使没有ticket验证也能及时熔断
+func (p *CASProvider) Available() (bool, time.Duration) {
+	if p.breaker == nil {
+		return true, 0
+	}
+	now := time.Now().UnixNano()
+	if now-p.lastProbe.Load() >= int64(p.probeInterval) && p.probing.CompareAndSwap(false, true) {
+		p.lastProbe.Store(now)
+		go p.probe()
+	}
+	return p.breaker.available()
+}
+
+// probe 探测CAS登录页并更新熔断器
+func (p *CASProvider) probe() {
+	defer p.probing.Store(false)
+	ctx, cancel := context.WithTimeout(context.Background(), p.client.http.Timeout)
+	defer cancel()
+	if err := p.client.probe(ctx, p.baseURL+p.loginPath); err != nil {
+		slog.Warn("CAS健康探测失败", "url", p.baseURL+p.loginPath, "error", err)
+		p.breaker.failure()
+		return
+	}
+	p.breaker.success()
+}
+
+// failureCode 返回验证失败的CAS错误码，CAS返回非200状态码时为 HTTP_<状态码>，其他错误（网络、解析）归为 REQUEST_ERROR
+func failureCode(err error) string {
+	var verr *auth.ValidationError
+	if errors.As(err, &verr) && verr.Code != "" {
+		return verr.Code
+	}
+	var serr *statusError
+	if errors.As(err, &serr) {
+		return fmt.Sprintf("HTTP_%d", serr.StatusCode)
+	}
+	return "REQUEST_ERROR"
+}
+
+// validateTicket 请求CAS服务器验证ticket，responded 表示CAS返回了响应（非 5xx），用于更新熔断器
+func (p *CASProvider) validateTicket(ctx context.Context, ticket, serviceURL string, opts auth.LoginOptions) (userInfo *auth.UserInfo, responded bool, err error) {
 	// 构建验证URL
 	validateURL := p.baseURL + p.validatePath
 	u, err := url.Parse(validateURL)
 	if err != nil {
-		return nil, fmt.Errorf("解析验证URL失败: %w", err)
+		return nil, false, fmt.Errorf("解析验证URL失败: %w", err)
 	}
 
 	q := u.Query()
 	q.Set("ticket", ticket)
 	q.Set("service", serviceURL)
 
+	// 强制重新认证时要求CAS只接受通过主凭证（密码）签发的ticket
+	if opts.Renew {
+		q.Set("renew", "true")
+	}
+
 	// 如果配置使用JSON格式，添加format=json参数
 	if p.useJSON {
 		q.Set("format", "json")
@@ -80,22 +224,19 @@ func (p *CASProvider) ValidateTicket(ticket, serviceURL string) (*auth.UserInfo,
 	u.RawQuery = q.Encode()
 
 	// 发送验证请求
-	resp, err := http.Get(u.String())
+	body, err := p.client.get(ctx, u.String())
 	if err != nil {
-		return nil, fmt.Errorf("验证请求失败: %w", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("读取响应失败: %w", err)
+		var serr *statusError
+		return nil, errors.As(err, &serr) && serr.StatusCode < 500, err
 	}
 
 	// 根据配置选择解析JSON或XML
 	if p.useJSON {
-		return p.parseJSONResponse(body)
+		userInfo, err = p.parseJSONResponse(body)
+	} else {
+		userInfo, err = p.parseXMLResponse(body)
 	}
-	return p.parseXMLResponse(body)
+	return userInfo, true, err
 }
 
 // ExtractTicket 从URL中提取ticket参数
@@ -125,15 +266,15 @@ func (p *CASProvider) IsLoginPath(rawURL string) bool {
 }
 
 // BuildServiceURL 构建服务URL（用于CAS回调）
+// 协议和主机名使用 Forwarded 中间件解析的值（只采信可信代理的转发头），未经过该中间件时取连接本身
 func (p *CASProvider) BuildServiceURL(req *http.Request, path string) string {
 	scheme := "http"
-	if req.TLS != nil || req.Header.Get("X-Forwarded-Proto") == "https" {
+	if req.TLS != nil {
 		scheme = "https"
 	}
-
 	host := req.Host
-	if host == "" {
-		host = req.Header.Get("Host")
+	if info := reqinfo.FromContext(req.Context()); info != nil && info.Scheme != "" {
+		scheme, host = info.Scheme, info.Host
 	}
 
 	return fmt.Sprintf("%s://%s%s", scheme, host, path)
@@ -149,7 +290,7 @@ func (p *CASProvider) parseJSONResponse(body []byte) (*auth.UserInfo, error) {
 	// 检查失败响应
 	if jsonResp.ServiceResponse.AuthenticationFailure != nil {
 		fail := jsonResp.ServiceResponse.AuthenticationFailure
-		return nil, fmt.Errorf("CAS验证失败 [%s]: %s", fail.Code, fail.Description)
+		return nil, &auth.ValidationError{Code: fail.Code, Description: fail.Description}
 	}
 
 	// 检查成功响应
@@ -188,7 +329,7 @@ func (p *CASProvider) parseXMLResponse(body []byte) (*auth.UserInfo, error) {
 	}
 
 	if serviceResp.Failure != nil {
-		return nil, fmt.Errorf("CAS验证失败 [%s]: %s", serviceResp.Failure.Code, serviceResp.Failure.Message)
+		return nil, &auth.ValidationError{Code: serviceResp.Failure.Code, Description: strings.TrimSpace(serviceResp.Failure.Message)}
 	}
 
 	if serviceResp.Success == nil || serviceResp.Success.User == "" {
@@ -0,0 +1,88 @@
+package cas
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"cas-gateway/auth"
+	"cas-gateway/models"
+)
+
+// newBreakerProvider 创建熔断阈值为 1 的 CASProvider，CAS 服务器由 handler 模拟
+func newBreakerProvider(t *testing.T, handler http.HandlerFunc) *CASProvider {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	p, err := NewCASProvider(&models.CASConfig{
+		BaseURL:             srv.URL,
+		BreakerThreshold:    1,
+		BreakerOpenDuration: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestValidateTicketBreaker(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		body      string
+		cancel    bool
+		wantState breakerState
+	}{
+		{"ticket无效视为CAS可用", http.StatusOK, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas"><cas:authenticationFailure code="INVALID_TICKET">bad</cas:authenticationFailure></cas:serviceResponse>`, false, stateClosed},
+		{"4xx视为CAS可用", http.StatusForbidden, "", false, stateClosed},
+		{"5xx计入失败", http.StatusBadGateway, "", false, stateOpen},
+		{"请求取消不计入", http.StatusOK, "", true, stateClosed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newBreakerProvider(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			})
+			ctx := context.Background()
+			if tt.cancel {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithCancel(ctx)
+				cancel()
+			}
+			if _, err := p.ValidateTicket(ctx, "ST-1", "http://app.test/", auth.LoginOptions{}); err == nil {
+				t.Fatal("期望验证失败")
+			}
+			if got := p.breaker.state; got != tt.wantState {
+				t.Fatalf("熔断器状态 = %s，期望 %s", got, tt.wantState)
+			}
+		})
+	}
+}
+
+func TestValidateTicketCancelledTrialKeepsBreakerOpen(t *testing.T) {
+	p := newBreakerProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+	// 模拟打开时长已过、进入半开状态
+	p.breaker.failure()
+	p.breaker.openedAt = time.Now().Add(-2 * time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p.ValidateTicket(ctx, "ST-1", "http://app.test/", auth.LoginOptions{})
+	if p.breaker.state != stateHalfOpen {
+		t.Fatalf("取消的试探请求不应关闭熔断器，状态 = %s", p.breaker.state)
+	}
+
+	// 试探被释放，下一个请求可以立即试探；CAS有响应后关闭
+	_, err := p.ValidateTicket(context.Background(), "ST-1", "http://app.test/", auth.LoginOptions{})
+	if errors.Is(err, auth.ErrUnavailable) {
+		t.Fatal("取消的试探请求未释放，新的试探被拒绝")
+	}
+	if p.breaker.state != stateClosed {
+		t.Fatalf("CAS有响应后熔断器状态 = %s，期望 closed", p.breaker.state)
+	}
+}
@@ -0,0 +1,175 @@
+package cas
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+	"cas-gateway/models"
+	"cas-gateway/tlsutil"
+	"cas-gateway/tracing"
+)
+
+// 验证请求 HTTP 客户端默认值
+const (
+	defaultTimeout         = 10 * time.Second
+	defaultConnectTimeout  = 3 * time.Second
+	defaultReadTimeout     = 5 * time.Second
+	defaultRetryBackoff    = 200 * time.Millisecond
+	defaultMaxResponseSize = 1 << 20
+
+	defaultBreakerThreshold    = 5
+	defaultBreakerOpenDuration = 30 * time.Second
+	defaultHealthCheckInterval = 10 * time.Second
+)
+
+// statusError CAS服务器返回非200状态码
+type statusError struct {
+	StatusCode int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("CAS服务器返回状态码 %d", e.StatusCode)
+}
+
+// casClient 请求CAS服务器的HTTP客户端，带超时、重试和响应大小限制
+type casClient struct {
+	http         *http.Client
+	retries      int
+	retryBackoff time.Duration
+	maxBody      int64
+}
+
+// newCASClient 根据配置创建HTTP客户端，未配置的参数使用默认值
+func newCASClient(cfg *models.CASConfig) (*casClient, error) {
+	tlsCfg, err := tlsutil.ClientConfig(&cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	connectTimeout := orDefault(cfg.ConnectTimeout, defaultConnectTimeout)
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   connectTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.TLSHandshakeTimeout = connectTimeout
+	transport.ResponseHeaderTimeout = orDefault(cfg.ReadTimeout, defaultReadTimeout)
+	// 所有验证请求都发往同一台CAS服务器，保留足够的空闲连接避免登录高峰时反复握手
+	transport.MaxIdleConnsPerHost = 32
+	if tlsCfg != nil {
+		transport.TLSClientConfig = tlsCfg
+	}
+
+	maxBody := cfg.MaxResponseSize
+	if maxBody <= 0 {
+		maxBody = defaultMaxResponseSize
+	}
+	return &casClient{
+		http: &http.Client{
+			Transport: transport,
+			Timeout:   orDefault(cfg.Timeout, defaultTimeout),
+		},
+		retries:      cfg.Retries,
+		retryBackoff: orDefault(cfg.RetryBackoff, defaultRetryBackoff),
+		maxBody:      maxBody,
+	}, nil
+}
+
+func orDefault(d, def time.Duration) time.Duration {
+	if d <= 0 {
+		return def
+	}
+	return d
+}
+
+// get 发送GET请求并返回响应体，5xx 和网络错误按退避间隔重试
+// 注意CAS ticket只能使用一次，请求已到达CAS但响应丢失时重试会得到 INVALID_TICKET
+func (c *casClient) get(ctx context.Context, rawURL string) ([]byte, error) {
+	backoff := c.retryBackoff
+	for attempt := 0; ; attempt++ {
+		body, err := c.do(ctx, rawURL)
+		if err == nil || attempt >= c.retries || !retryable(err) || ctx.Err() != nil {
+			return body, err
+		}
+		slog.WarnContext(ctx, "CAS验证请求失败，准备重试", "attempt", attempt+1, "backoff", backoff.String(), "error", err)
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// do 发送一次请求，非200状态码和超过大小限制的响应都返回错误，不交给解析器
+func (c *casClient) do(ctx context.Context, rawURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建验证请求失败: %w", err)
+	}
+	tracing.Inject(ctx, req.Header)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		// url.Error 包含带 ticket 的完整URL，只保留底层错误，避免 ticket 写入日志
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		return nil, fmt.Errorf("验证请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		// 读掉少量响应体以便复用连接
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		return nil, &statusError{StatusCode: resp.StatusCode}
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, c.maxBody+1))
+	if err != nil {
+		return nil, fmt.Errorf("读取响应失败: %w", err)
+	}
+	if int64(len(body)) > c.maxBody {
+		return nil, fmt.Errorf("CAS响应超过大小限制 %d 字节", c.maxBody)
+	}
+	return body, nil
+}
+
+// retryable 只重试 5xx 和网络错误；4xx、响应过大等重试也不会成功
+func retryable(err error) bool {
+	var serr *statusError
+	if errors.As(err, &serr) {
+		return serr.StatusCode >= 500
+	}
+	var nerr net.Error
+	return errors.As(err, &nerr)
+}
+
+// probe 探测CAS服务器是否可用，能返回非 5xx 响应即视为可用
+func (c *casClient) probe(ctx context.Context, rawURL string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, c.maxBody))
+	if resp.StatusCode >= 500 {
+		return &statusError{StatusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+// casUnavailable 判断错误是否说明CAS服务不可用（计入熔断），ticket无效等CAS正常响应的错误不计入
+func casUnavailable(err error) bool {
+	return retryable(err) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -1,14 +1,21 @@
 package auth
 
-import "net/http"
+import (
+	"context"
+	"net/http"
+	"time"
+)
 
 // Provider 认证提供者接口
 type Provider interface {
 	// GetLoginURL 获取登录URL
-	GetLoginURL(serviceURL string) string
+	GetLoginURL(serviceURL string, opts LoginOptions) string
 
-	// ValidateTicket 验证ticket，返回用户信息
-	ValidateTicket(ticket, serviceURL string) (*UserInfo, error)
+	// GetLogoutURL 获取登出URL，serviceURL 为登出后跳转地址，为空时不跳转
+	GetLogoutURL(serviceURL string) string
+
+	// ValidateTicket 验证ticket，返回用户信息；ctx 用于追踪和取消请求
+	ValidateTicket(ctx context.Context, ticket, serviceURL string, opts LoginOptions) (*UserInfo, error)
 
 	// ExtractTicket 从URL中提取ticket参数
 	ExtractTicket(rawURL string) (string, error)
@@ -18,4 +25,7 @@ type Provider interface {
 
 	// BuildServiceURL 构建服务URL（用于回调）
 	BuildServiceURL(req *http.Request, path string) string
+
+	// Available 认证服务当前是否可用，不可用时返回建议客户端重试的等待时间
+	Available() (bool, time.Duration)
 }
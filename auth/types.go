@@ -1,8 +1,32 @@
 package auth
 
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnavailable 认证服务暂时不可用（熔断器打开），此时不应跳转登录页
+var ErrUnavailable = errors.New("认证服务暂时不可用")
+
 // UserInfo 用户信息
 type UserInfo struct {
 	Oaid         string                 `json:"oaid"`
 	EmployeeName string                 `json:"employeeName"`
 	Extra        map[string]interface{} `json:"extra"`
 }
+
+// LoginOptions CAS 登录/验证的附加参数
+type LoginOptions struct {
+	Renew   bool // 强制重新认证（renew=true），登录跳转和ticket验证都需要携带
+	Gateway bool // 网关模式（gateway=true），CAS不展示登录页，无SSO会话时直接回跳且不带ticket
+}
+
+// ValidationError CAS服务器返回的ticket验证失败（authenticationFailure）
+type ValidationError struct {
+	Code        string // CAS错误码，如 INVALID_TICKET
+	Description string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("CAS验证失败 [%s]: %s", e.Code, e.Description)
+}
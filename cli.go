@@ -0,0 +1,212 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"cas-gateway/audit"
+	"cas-gateway/config"
+)
+
+// 构建信息，通过 -ldflags "-X main.version=v1.2.3 -X main.commit=abc123 -X main.buildDate=2024-01-01" 注入
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+const defaultConfigPath = "config.yaml"
+
+const usage = `用法: cas-gateway <命令> [参数]
+
+命令:
+  serve          启动网关（默认命令）
+  check-config   检查配置文件
+  gen-key        生成随机 session_key
+  verify-audit   校验审计日志哈希链
+  version        显示版本信息
+
+兼容旧用法: cas-gateway [配置文件路径]
+
+使用 "cas-gateway <命令> -h" 查看命令参数
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run 解析子命令并执行，返回进程退出码
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		serve(serveOptions{configPath: defaultConfigPath})
+		return 0
+	}
+
+	switch args[0] {
+	case "serve":
+		return runServe(args[1:], stderr)
+	case "check-config":
+		return runCheckConfig(args[1:], stdout, stderr)
+	case "gen-key":
+		return runGenKey(args[1:], stdout, stderr)
+	case "verify-audit":
+		return runVerifyAudit(args[1:], stdout, stderr)
+	case "version", "-version", "--version":
+		printVersion(stdout)
+		return 0
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	}
+
+	// 兼容旧用法：第一个参数为配置文件路径，或直接使用 serve 的参数（如 -config）
+	if len(args) == 1 && args[0] != "" && args[0][0] != '-' {
+		serve(serveOptions{configPath: args[0]})
+		return 0
+	}
+	if args[0] != "" && args[0][0] == '-' {
+		return runServe(args, stderr)
+	}
+	fmt.Fprintf(stderr, "未知命令: %s\n\n%s", args[0], usage)
+	return 2
+}
+
+func runServe(args []string, stderr io.Writer) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var opts serveOptions
+	fs.StringVar(&opts.configPath, "config", defaultConfigPath, "配置文件路径")
+	fs.StringVar(&opts.logFile, "logfile", "", "日志输出文件（追加写入），默认输出到标准输出")
+	fs.StringVar(&opts.pidFile, "pidfile", "", "PID 文件路径，退出时删除")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(stderr, "多余的参数: %v\n", fs.Args())
+		return 2
+	}
+	serve(opts)
+	return 0
+}
+
+func runCheckConfig(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("check-config", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	configPath := fs.String("config", defaultConfigPath, "配置文件路径")
+	strict := fs.Bool("strict", false, "存在警告时也返回非零退出码")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	switch fs.NArg() {
+	case 0:
+	case 1:
+		*configPath = fs.Arg(0)
+	default:
+		fmt.Fprintf(stderr, "多余的参数: %v\n", fs.Args()[1:])
+		return 2
+	}
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", *configPath, err)
+		return 1
+	}
+	warnings := config.Lint(cfg)
+	for _, w := range warnings {
+		fmt.Fprintf(stdout, "警告: %s\n", w)
+	}
+	if len(warnings) > 0 && *strict {
+		return 1
+	}
+	fmt.Fprintf(stdout, "%s: 配置有效\n", *configPath)
+	return 0
+}
+
+func runGenKey(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("gen-key", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	size := fs.Int("bytes", 32, "随机字节数（session_key 至少需要 32 字节）")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *size < 32 {
+		fmt.Fprintln(stderr, "随机字节数不能少于 32")
+		return 2
+	}
+
+	key := make([]byte, *size)
+	if _, err := rand.Read(key); err != nil {
+		fmt.Fprintf(stderr, "生成密钥失败: %v\n", err)
+		return 1
+	}
+	fmt.Fprintln(stdout, base64.StdEncoding.EncodeToString(key))
+	return 0
+}
+
+func runVerifyAudit(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("verify-audit", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	configPath := fs.String("config", defaultConfigPath, "配置文件路径，未指定审计日志文件时使用其中的 audit.path")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	var path string
+	switch fs.NArg() {
+	case 0:
+		cfg, err := config.LoadConfig(*configPath)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", *configPath, err)
+			return 1
+		}
+		if cfg.Audit.Path == "" || !cfg.Audit.HashChain {
+			fmt.Fprintf(stderr, "%s: 未配置审计日志或未启用 audit.hash_chain\n", *configPath)
+			return 2
+		}
+		path = cfg.Audit.Path
+	case 1:
+		path = fs.Arg(0)
+	default:
+		fmt.Fprintf(stderr, "多余的参数: %v\n", fs.Args()[1:])
+		return 2
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(stderr, "打开审计日志失败: %v\n", err)
+		return 1
+	}
+	defer f.Close()
+	if err := audit.Verify(f); err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", path, err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "%s: 哈希链校验通过\n", path)
+	return 0
+}
+
+func printVersion(w io.Writer) {
+	rev, date := commit, buildDate
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			switch {
+			case s.Key == "vcs.revision" && rev == "":
+				rev = s.Value
+			case s.Key == "vcs.time" && date == "":
+				date = s.Value
+			}
+		}
+	}
+	fmt.Fprintf(w, "cas-gateway %s\n", version)
+	if rev != "" {
+		fmt.Fprintf(w, "  commit:     %s\n", rev)
+	}
+	if date != "" {
+		fmt.Fprintf(w, "  built:      %s\n", date)
+	}
+	fmt.Fprintf(w, "  go version: %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
@@ -2,14 +2,23 @@
 
 import (
 	"fmt"
+	"io"
+	"net"
+	"net/url"
 	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"cas-gateway/logging"
 	"cas-gateway/models"
+	"cas-gateway/netutil"
+	"cas-gateway/pages"
+	"cas-gateway/tlsutil"
 
 	"gopkg.in/yaml.v3"
 )
 
-var AppConfig *models.Config
-
 // LoadConfig 加载配置文件
 func LoadConfig(path string) (*models.Config, error) {
 	data, err := os.ReadFile(path)
@@ -17,34 +26,156 @@ func LoadConfig(path string) (*models.Config, error) {
 		return nil, fmt.Errorf("读取配置文件失败: %w", err)
 	}
 
-	var cfg models.Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
+	// 解析为节点树，展开 ${VAR} 并读取 xxx_file 密钥文件后再解码
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
 		return nil, fmt.Errorf("解析配置文件失败: %w", err)
 	}
+	if err := expandEnv(&root); err != nil {
+		return nil, fmt.Errorf("展开环境变量失败: %w", err)
+	}
+	var cfg models.Config
+	if err := resolveSecretFiles(&root, reflect.TypeOf(cfg)); err != nil {
+		return nil, fmt.Errorf("读取密钥文件失败: %w", err)
+	}
+	if len(root.Content) > 0 {
+		if err := root.Decode(&cfg); err != nil {
+			return nil, fmt.Errorf("解析配置文件失败: %w", err)
+		}
+	}
+
+	// CASGW_* 环境变量优先于配置文件
+	if err := applyEnvOverrides(reflect.ValueOf(&cfg).Elem(), EnvPrefix); err != nil {
+		return nil, err
+	}
+
+	// 填充默认值
+	if cfg.Server.ShutdownTimeout == 0 {
+		cfg.Server.ShutdownTimeout = 30 * time.Second
+	}
+	if cfg.Server.TLS.ReloadInterval == 0 {
+		cfg.Server.TLS.ReloadInterval = time.Minute
+	}
+	if cfg.Metrics.Path == "" {
+		cfg.Metrics.Path = "/metrics"
+	}
+	if cfg.Tracing.ServiceName == "" {
+		cfg.Tracing.ServiceName = "cas-gateway"
+	}
+	if cfg.Tracing.SampleRatio == 0 {
+		cfg.Tracing.SampleRatio = 1
+	}
+	if cfg.Log.MaxSizeMB == 0 {
+		cfg.Log.MaxSizeMB = 100
+	}
+	if cfg.Log.MaxBackups == 0 {
+		cfg.Log.MaxBackups = 5
+	}
+	if cfg.AccessLog.MaxSizeMB == 0 {
+		cfg.AccessLog.MaxSizeMB = 100
+	}
+	if cfg.AccessLog.MaxBackups == 0 {
+		cfg.AccessLog.MaxBackups = 5
+	}
 
 	// 验证配置
 	if err := validateConfig(&cfg); err != nil {
 		return nil, fmt.Errorf("配置验证失败: %w", err)
 	}
 
-	AppConfig = &cfg
 	return &cfg, nil
 }
 
+// validateTLS 验证 TLS 配置，并尝试加载证书以便启动前发现证书问题
+func validateTLS(server *models.ServerConfig) error {
+	t := &server.TLS
+	if !t.Enabled {
+		return nil
+	}
+	certs := t.AllCertificates()
+	if len(certs) == 0 {
+		return fmt.Errorf("启用 TLS 时必须配置 cert_file 和 key_file")
+	}
+	for _, c := range certs {
+		if c.CertFile == "" || c.KeyFile == "" {
+			return fmt.Errorf("TLS 证书的 cert_file 和 key_file 必须同时配置")
+		}
+	}
+	if _, err := tlsutil.ParseMinVersion(t.MinVersion); err != nil {
+		return err
+	}
+	if _, err := tlsutil.ParseCipherSuites(t.CipherSuites); err != nil {
+		return err
+	}
+	if _, err := tlsutil.NewCertStore(certs); err != nil {
+		return err
+	}
+	if t.HTTPRedirectPort < 0 || t.HTTPRedirectPort > 65535 || t.HTTPRedirectPort == server.Port {
+		return fmt.Errorf("http_redirect_port 无效: %d", t.HTTPRedirectPort)
+	}
+	if t.ReloadInterval < 0 {
+		return fmt.Errorf("tls.reload_interval 不能为负数")
+	}
+	return nil
+}
+
 // validateConfig 验证配置有效性
 func validateConfig(cfg *models.Config) error {
 	if cfg.Server.Port <= 0 || cfg.Server.Port > 65535 {
 		return fmt.Errorf("服务器端口无效: %d", cfg.Server.Port)
 	}
 
+	if cfg.Server.PreStopDelay < 0 || cfg.Server.ShutdownTimeout < 0 {
+		return fmt.Errorf("pre_stop_delay 和 shutdown_timeout 不能为负数")
+	}
+
 	if len(cfg.Server.SessionKey) < 32 {
 		return fmt.Errorf("session_key 必须至少32字节")
 	}
 
+	if _, err := netutil.ParseIPSet(cfg.Server.TrustedProxies); err != nil {
+		return fmt.Errorf("trusted_proxies 无效: %w", err)
+	}
+
+	if pp := cfg.Server.ProxyProtocol; pp.Enabled {
+		if len(pp.AllowedCIDRs) == 0 {
+			return fmt.Errorf("启用 server.proxy_protocol 时必须配置 allowed_cidrs")
+		}
+		if _, err := netutil.ParseIPSet(pp.AllowedCIDRs); err != nil {
+			return fmt.Errorf("server.proxy_protocol.allowed_cidrs 无效: %w", err)
+		}
+		if pp.HeaderTimeout < 0 {
+			return fmt.Errorf("server.proxy_protocol.header_timeout 不能为负数")
+		}
+	}
+
+	if err := validateTLS(&cfg.Server); err != nil {
+		return err
+	}
+
 	// 验证CAS配置
 	if cfg.CAS.BaseURL == "" {
 		return fmt.Errorf("CAS base_url 不能为空")
 	}
+	if cfg.CAS.Timeout < 0 || cfg.CAS.ConnectTimeout < 0 || cfg.CAS.ReadTimeout < 0 || cfg.CAS.RetryBackoff < 0 {
+		return fmt.Errorf("CAS 超时和重试间隔不能为负数")
+	}
+	if cfg.CAS.Retries < 0 || cfg.CAS.Retries > 5 {
+		return fmt.Errorf("CAS retries 无效: %d（0-5）", cfg.CAS.Retries)
+	}
+	if cfg.CAS.BreakerThreshold < -1 || cfg.CAS.BreakerOpenDuration < 0 || cfg.CAS.HealthCheckInterval < 0 {
+		return fmt.Errorf("CAS 熔断配置无效：breaker_threshold 不能小于 -1，时长不能为负数")
+	}
+	if cfg.CAS.MaxResponseSize < 0 {
+		return fmt.Errorf("CAS max_response_size 不能为负数")
+	}
+	if _, err := tlsutil.ClientConfig(&cfg.CAS.TLS); err != nil {
+		return fmt.Errorf("cas.tls 无效: %w", err)
+	}
+
+	if _, err := pages.Load(&cfg.Pages); err != nil {
+		return err
+	}
 
 	// 验证路由配置
 	if cfg.Route.Name == "" {
@@ -56,6 +187,224 @@ func validateConfig(cfg *models.Config) error {
 	if cfg.Route.Target == "" {
 		return fmt.Errorf("路由目标不能为空: %s", cfg.Route.Name)
 	}
+	if _, err := tlsutil.ClientConfig(&cfg.Route.TLS); err != nil {
+		return fmt.Errorf("route.tls 无效: %w", err)
+	}
+	for _, target := range cfg.Route.Targets {
+		if target == "" {
+			return fmt.Errorf("route.targets 不能包含空地址")
+		}
+		if _, err := url.Parse(target); err != nil {
+			return fmt.Errorf("route.targets 地址无效: %w", err)
+		}
+	}
+	if cfg.Route.PublicURL != "" {
+		u, err := url.Parse(cfg.Route.PublicURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("route.public_url 必须是完整的 http(s) 地址: %s", cfg.Route.PublicURL)
+		}
+		if (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+			return fmt.Errorf("route.public_url 只能包含协议和主机名（路径使用 route.path）: %s", cfg.Route.PublicURL)
+		}
+	}
+	if cfg.Route.Retries < 0 {
+		return fmt.Errorf("route.retries 不能为负数")
+	}
+	if cfg.Route.DialTimeout < 0 || cfg.Route.TLSHandshakeTimeout < 0 || cfg.Route.ResponseHeaderTimeout < 0 {
+		return fmt.Errorf("route 超时不能为负数")
+	}
+	if _, err := netutil.ParseIPSet(cfg.Route.Maintenance.AllowIPs); err != nil {
+		return fmt.Errorf("maintenance.allow_ips 无效: %w", err)
+	}
+	if cfg.Route.Maintenance.RetryAfter < 0 {
+		return fmt.Errorf("maintenance.retry_after 不能为负数")
+	}
+	for _, redirect := range cfg.Route.Logout.AllowedRedirects {
+		u, err := url.Parse(redirect)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+			return fmt.Errorf("route.logout.allowed_redirects 必须是完整的 http(s) 地址: %s", redirect)
+		}
+	}
+	for i, rule := range cfg.Route.IPRules {
+		if rule.Path != "" && !strings.HasPrefix(rule.Path, "/") {
+			return fmt.Errorf("route.ip_rules[%d].path 必须以 / 开头: %q", i, rule.Path)
+		}
+		if len(rule.Allow) == 0 && len(rule.Deny) == 0 {
+			return fmt.Errorf("route.ip_rules[%d] 至少需要配置 allow 或 deny", i)
+		}
+		if _, err := netutil.ParseIPSet(rule.Allow); err != nil {
+			return fmt.Errorf("route.ip_rules[%d].allow 无效: %w", i, err)
+		}
+		if _, err := netutil.ParseIPSet(rule.Deny); err != nil {
+			return fmt.Errorf("route.ip_rules[%d].deny 无效: %w", i, err)
+		}
+	}
+	for i, rl := range cfg.Route.RateLimits {
+		if rl.Path != "" && !strings.HasPrefix(rl.Path, "/") {
+			return fmt.Errorf("route.rate_limits[%d].path 必须以 / 开头: %q", i, rl.Path)
+		}
+		switch rl.Key {
+		case "", models.RateLimitKeyUser, models.RateLimitKeyIP, models.RateLimitKeyToken:
+		default:
+			return fmt.Errorf("route.rate_limits[%d].key 无效: %q（可选值 user、ip、token）", i, rl.Key)
+		}
+		if rl.Rate <= 0 {
+			return fmt.Errorf("route.rate_limits[%d].rate 必须大于0", i)
+		}
+		if rl.Burst < 0 {
+			return fmt.Errorf("route.rate_limits[%d].burst 不能为负数", i)
+		}
+	}
+	for status, path := range cfg.Route.ErrorPages {
+		switch status {
+		case 403, 502, 503, 504:
+		default:
+			return fmt.Errorf("route.error_pages 只支持 403、502、503、504: %d", status)
+		}
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("route.error_pages 文件无效: %w", err)
+		}
+	}
+	switch cfg.Route.Auth {
+	case "", models.AuthModeRequired, models.AuthModeOptional:
+	default:
+		return fmt.Errorf("路由认证模式无效: %q（可选值 required、optional）", cfg.Route.Auth)
+	}
+	for _, p := range cfg.Route.OptionalPaths {
+		if !strings.HasPrefix(p, "/") {
+			return fmt.Errorf("optional_paths 路径必须以 / 开头: %q", p)
+		}
+	}
+
+	if _, err := logging.New(cfg.Log, io.Discard); err != nil {
+		return err
+	}
+
+	if cfg.Metrics.Enabled {
+		if !strings.HasPrefix(cfg.Metrics.Path, "/") {
+			return fmt.Errorf("metrics path 必须以 / 开头: %q", cfg.Metrics.Path)
+		}
+		if cfg.Metrics.Listen == "" && isReservedPath(cfg.Metrics.Path) {
+			return fmt.Errorf("metrics path 与网关内置路径冲突: %s", cfg.Metrics.Path)
+		}
+	}
+
+	if cfg.AccessLog.Enabled {
+		switch cfg.AccessLog.Format {
+		case "", "combined", "common", "json":
+		case "template":
+			if cfg.AccessLog.Template == "" {
+				return fmt.Errorf("access_log format 为 template 时必须配置 template")
+			}
+		default:
+			return fmt.Errorf("访问日志格式无效: %q（可选值 combined、common、json、template）", cfg.AccessLog.Format)
+		}
+	}
+
+	if cfg.Audit.Enabled && cfg.Audit.Path == "" {
+		return fmt.Errorf("audit 启用时必须配置 path")
+	}
+
+	if cfg.Tracing.Enabled {
+		switch cfg.Tracing.Exporter {
+		case "otlp-http", "otlp-grpc":
+			if cfg.Tracing.Endpoint == "" {
+				return fmt.Errorf("tracing exporter 为 %s 时必须配置 endpoint", cfg.Tracing.Exporter)
+			}
+		case "file":
+			if cfg.Tracing.Path == "" {
+				return fmt.Errorf("tracing exporter 为 file 时必须配置 path")
+			}
+		case "stdout":
+		default:
+			return fmt.Errorf("追踪导出器无效: %q（可选值 otlp-http、otlp-grpc、stdout、file）", cfg.Tracing.Exporter)
+		}
+		if cfg.Tracing.SampleRatio < 0 || cfg.Tracing.SampleRatio > 1 {
+			return fmt.Errorf("tracing sample_ratio 必须在 0~1 之间: %v", cfg.Tracing.SampleRatio)
+		}
+	}
+
+	// 管理端点不经过 CAS 认证，监听非本机地址时必须配置 token，否则任何能访问该端口的人都可以开关维护模式
+	if cfg.Admin.Listen != "" && cfg.Admin.Token == "" {
+		if host, _, err := net.SplitHostPort(cfg.Admin.Listen); err != nil || !isLoopback(host) {
+			return fmt.Errorf("admin.listen 不是本机地址时必须配置 token: %s", cfg.Admin.Listen)
+		}
+	}
+
+	for _, rule := range cfg.Route.Renew {
+		if !strings.HasPrefix(rule.Path, "/") {
+			return fmt.Errorf("renew 路径必须以 / 开头: %q", rule.Path)
+		}
+		if rule.MaxAge < 0 {
+			return fmt.Errorf("renew max_age 不能为负数: %s", rule.Path)
+		}
+	}
 
 	return nil
 }
+
+// isReservedPath 判断路径是否与网关内置端点冲突
+func isReservedPath(path string) bool {
+	return path == "/" || path == "/health" || path == "/logout"
+}
+
+// Lint 检查不影响启动但可能有问题的配置（不访问网络），返回警告列表
+func Lint(cfg *models.Config) []string {
+	var warnings []string
+	warn := func(format string, args ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}
+
+	if strings.HasSuffix(cfg.CAS.BaseURL, "/") {
+		warn("cas.base_url 以 / 结尾，与 login_path/validate_path 拼接后会出现 //: %s", cfg.CAS.BaseURL)
+	}
+	if u, err := url.Parse(cfg.CAS.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+		warn("cas.base_url 不是完整的URL: %s", cfg.CAS.BaseURL)
+	} else if u.Scheme != "https" {
+		warn("cas.base_url 未使用 HTTPS，ticket 验证可能被窃听: %s", cfg.CAS.BaseURL)
+	}
+	for name, p := range map[string]string{"cas.login_path": cfg.CAS.LoginPath, "cas.logout_path": cfg.CAS.LogoutPath, "cas.validate_path": cfg.CAS.ValidatePath} {
+		if p != "" && !strings.HasPrefix(p, "/") {
+			warn("%s 应以 / 开头: %s", name, p)
+		}
+	}
+
+	if cfg.Route.Path != "/" && strings.HasSuffix(cfg.Route.Path, "/") {
+		warn("route.path 以 / 结尾，前缀匹配和剥离可能不符合预期: %s", cfg.Route.Path)
+	}
+	if !strings.HasPrefix(cfg.Route.Path, "/") {
+		warn("route.path 应以 / 开头: %s", cfg.Route.Path)
+	}
+	for _, target := range cfg.Route.AllTargets() {
+		if u, err := url.Parse(target); err != nil || u.Scheme == "" || u.Host == "" {
+			warn("route.target 不是完整的URL（需包含 http:// 或 https://）: %s", target)
+		}
+	}
+
+	if cfg.Route.PublicURL == "" {
+		warn("未配置 route.public_url，CAS service 地址取自请求的 Host 头（经过反向代理时需配置 server.trusted_proxies）")
+	}
+
+	if strings.Contains(cfg.Server.SessionKey, "your-secret") {
+		warn("server.session_key 仍是示例值，请使用 gen-key 生成随机密钥")
+	}
+	for name, t := range map[string]models.ClientTLSConfig{"cas.tls": cfg.CAS.TLS, "route.tls": cfg.Route.TLS} {
+		if t.InsecureSkipVerify {
+			warn("%s.insecure_skip_verify 已开启，不校验服务器证书，仅应用于开发环境", name)
+		}
+	}
+	if cfg.Metrics.Enabled && cfg.Metrics.Listen == "" {
+		warn("metrics 与网关共用端口且不经过认证，%s 对外可访问", cfg.Metrics.Path)
+	}
+	sort.Strings(warnings)
+	return warnings
+}
+
+// isLoopback 判断监听地址是否只在本机可访问
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,213 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix 环境变量覆盖配置的前缀，如 CASGW_SERVER_PORT 覆盖 server.port
+const EnvPrefix = "CASGW"
+
+// envRefRegex 匹配 ${VAR} 和 ${VAR:-default}
+var envRefRegex = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandEnv 展开 YAML 标量值中的 ${VAR}，变量未设置且没有默认值时报错
+func expandEnv(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		var missing []string
+		expanded := envRefRegex.ReplaceAllStringFunc(node.Value, func(ref string) string {
+			m := envRefRegex.FindStringSubmatch(ref)
+			if v, ok := os.LookupEnv(m[1]); ok {
+				return v
+			}
+			if m[2] != "" {
+				return m[3]
+			}
+			missing = append(missing, m[1])
+			return ""
+		})
+		if len(missing) > 0 {
+			return fmt.Errorf("第 %d 行引用的环境变量未设置: %s", node.Line, strings.Join(missing, ", "))
+		}
+		if expanded != node.Value {
+			node.Value = expanded
+			// 未加引号的值按展开后的内容重新推断类型（如端口号为整数）
+			if node.Style == 0 {
+				node.Tag = ""
+			}
+		}
+		return nil
+	}
+	for _, child := range node.Content {
+		if err := expandEnv(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveSecretFiles 将 xxx_file 键替换为从文件读取的 xxx 值（如 session_key_file -> session_key）
+// 仅对结构体中存在对应字符串字段、且没有同名 xxx_file 字段的键生效，避免误伤 cert_file 等普通配置
+func resolveSecretFiles(node *yaml.Node, t reflect.Type) error {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if node.Kind == yaml.DocumentNode {
+		for _, child := range node.Content {
+			if err := resolveSecretFiles(child, t); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Slice:
+		if node.Kind == yaml.SequenceNode {
+			for _, item := range node.Content {
+				if err := resolveSecretFiles(item, t.Elem()); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	case reflect.Struct:
+	default:
+		return nil
+	}
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	fields := yamlFields(t)
+	present := make(map[string]bool)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		present[node.Content[i].Value] = true
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if f, ok := fields[key.Value]; ok {
+			if err := resolveSecretFiles(value, f.Type); err != nil {
+				return err
+			}
+			continue
+		}
+		base, isFile := strings.CutSuffix(key.Value, "_file")
+		f, ok := fields[base]
+		if !isFile || !ok || f.Type.Kind() != reflect.String {
+			continue
+		}
+		if present[base] {
+			return fmt.Errorf("%s 和 %s 不能同时配置", base, key.Value)
+		}
+		secret, err := readSecretFile(value.Value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key.Value, err)
+		}
+		key.Value = base
+		value.Kind, value.Tag, value.Style, value.Value = yaml.ScalarNode, "!!str", 0, secret
+	}
+	return nil
+}
+
+// readSecretFile 读取密钥文件，去除末尾换行（兼容 systemd LoadCredential 和 Kubernetes Secret 挂载）
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("读取密钥文件失败: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// applyEnvOverrides 用 CASGW_<节>_<字段> 环境变量覆盖配置，字符串字段同样支持 _FILE 后缀从文件读取
+// 非字符串字段按 YAML 解析（如 CASGW_ROUTE_RENEW='[{path: /a, max_age: 5m}]'），字符串列表也可用逗号分隔
+func applyEnvOverrides(v reflect.Value, prefix string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := yamlName(f)
+		if tag == "" || !f.IsExported() {
+			continue
+		}
+		name := prefix + "_" + strings.ToUpper(tag)
+		field := v.Field(i)
+
+		if f.Type.Kind() == reflect.Struct {
+			if err := applyEnvOverrides(field, name); err != nil {
+				return err
+			}
+			continue
+		}
+
+		raw, ok := os.LookupEnv(name)
+		if f.Type.Kind() == reflect.String {
+			if path, fileOK := os.LookupEnv(name + "_FILE"); fileOK {
+				if ok {
+					return fmt.Errorf("%s 和 %s_FILE 不能同时设置", name, name)
+				}
+				secret, err := readSecretFile(path)
+				if err != nil {
+					return fmt.Errorf("%s_FILE: %w", name, err)
+				}
+				raw, ok = secret, true
+			}
+		}
+		if !ok {
+			continue
+		}
+		if err := setFromString(field, raw); err != nil {
+			return fmt.Errorf("环境变量 %s 无效: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// setFromString 按字段类型解析环境变量值
+func setFromString(field reflect.Value, raw string) error {
+	switch {
+	case field.Kind() == reflect.String:
+		field.SetString(raw)
+		return nil
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String && !strings.HasPrefix(strings.TrimSpace(raw), "["):
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+		return nil
+	}
+	// 先解析到新值再赋值，避免解析失败时留下部分结果
+	ptr := reflect.New(field.Type())
+	if err := yaml.Unmarshal([]byte(raw), ptr.Interface()); err != nil {
+		return err
+	}
+	field.Set(ptr.Elem())
+	return nil
+}
+
+// yamlFields 返回结构体 yaml 键到字段的映射
+func yamlFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if name := yamlName(f); name != "" {
+			fields[name] = f
+		}
+	}
+	return fields
+}
+
+func yamlName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+	if name == "-" {
+		return ""
+	}
+	return name
+}
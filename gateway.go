@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"cas-gateway/audit"
+	"cas-gateway/auth/cas"
+	"cas-gateway/middleware"
+	"cas-gateway/models"
+	"cas-gateway/pages"
+	"cas-gateway/proxy"
+)
+
+// gatewayState 跨配置重载保留的运行时状态，由 serve 创建并传给每次构建的网关
+type gatewayState struct {
+	auditor     *audit.Logger // 为 nil 时不记录审计日志
+	draining    atomic.Bool   // 关闭阶段，/health 返回503
+	maintenance *middleware.MaintenanceState
+	streams     *middleware.StreamRegistry
+
+	// CAS认证提供者，CAS配置未变化时重载沿用，保留熔断器状态和连接池（重载由 reloader 串行化）
+	casProvider *cas.CASProvider
+	casConfig   models.CASConfig
+}
+
+// authProvider 返回CAS认证提供者，CAS配置与上次构建成功的网关相同时沿用旧实例
+func (s *gatewayState) authProvider(cfg *models.CASConfig) (*cas.CASProvider, error) {
+	if s.casProvider != nil && reflect.DeepEqual(s.casConfig, *cfg) {
+		return s.casProvider, nil
+	}
+	return cas.NewCASProvider(cfg)
+}
+
+// newGateway 根据配置构建网关处理器（代理、CAS认证、路由和内置端点）
+// 不持有需要关闭的资源，配置重载时可直接丢弃旧实例
+func newGateway(cfg *models.Config, state *gatewayState) (http.Handler, error) {
+	// 页面模板，传给输出页面的代理和中间件，随网关实例一起替换
+	pageSet, err := pages.Load(&cfg.Pages)
+	if err != nil {
+		return nil, fmt.Errorf("加载页面模板失败: %w", err)
+	}
+
+	// 创建代理管理器
+	proxyManager, err := proxy.NewProxyManager(&cfg.Route, pageSet)
+	if err != nil {
+		return nil, fmt.Errorf("创建代理管理器失败: %w", err)
+	}
+
+	// 创建CAS认证提供者
+	casProvider, err := state.authProvider(&cfg.CAS)
+	if err != nil {
+		return nil, fmt.Errorf("创建CAS认证提供者失败: %w", err)
+	}
+
+	// 创建认证中间件
+	authMiddleware := middleware.NewAuthMiddleware(&cfg.Server, proxyManager, casProvider, state.auditor, state.streams, pageSet)
+
+	// 维护模式检查（在认证之前，未登录的用户不会跳转CAS登录；静态文件同样检查）
+	maint, err := middleware.NewMaintenance(&cfg.Route, state.maintenance, authMiddleware.GetUser, pageSet)
+	if err != nil {
+		return nil, err
+	}
+
+	// 客户端IP访问规则
+	ipFilter, err := middleware.NewIPFilter(&cfg.Route, proxyManager.ErrorPage(http.StatusForbidden), state.auditor, pageSet)
+	if err != nil {
+		return nil, err
+	}
+
+	// 限流（在认证之后、转发之前）
+	proxyManager.Wrap(middleware.NewRateLimiter(&cfg.Route, authMiddleware.GetUser, pageSet).Handler)
+
+	// 创建HTTP处理器
+	mux := http.NewServeMux()
+
+	// 注册路由处理器（所有请求都转发到同一个后端）
+	proxyHandler := proxyManager.GetProxy()
+	route := proxyManager.GetRoute()
+	
+	// 如果配置了路径前缀，注册带路径前缀的路由
+	if route.Path != "" && route.Path != "/" {
+		// 注册带尾斜杠的路径（会匹配所有子路径）
+		mux.Handle(route.Path+"/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			slog.DebugContext(r.Context(), "路由处理请求", "route", route.Name, "method", r.Method, "path", r.URL.Path)
+			// 剥离路径前缀
+			r.URL.Path = strings.TrimPrefix(r.URL.Path, route.Path)
+			if r.URL.Path == "" {
+				r.URL.Path = "/"
+			}
+			proxyHandler.ServeHTTP(w, r)
+		}))
+
+		// 注册精确路径（用于匹配路径本身）
+		mux.Handle(route.Path, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			slog.DebugContext(r.Context(), "路由处理请求", "route", route.Name, "method", r.Method, "path", r.URL.Path)
+			r.URL.Path = "/"
+			proxyHandler.ServeHTTP(w, r)
+		}))
+	}
+
+	slog.Info("路由已注册", "route", route.Name, "path", route.Path, "upstream", route.Target)
+
+	// 健康检查端点（关闭阶段返回503，让负载均衡器摘除流量）
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		if state.draining.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintf(w, "DRAINING")
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "OK")
+	})
+
+	// 登出端点
+	mux.HandleFunc("/logout", authMiddleware.HandleLogout)
+
+	// 添加通配符路由，处理所有未匹配的请求（如 /api/...、/static/... 等）
+	// 所有请求都转发到同一个后端服务
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		// 跳过已经注册的路径
+		if r.URL.Path == "/health" || r.URL.Path == "/logout" {
+			return
+		}
+		// 如果请求路径包含路由前缀，需要剥离前缀
+		if route.Path != "" && route.Path != "/" && strings.HasPrefix(r.URL.Path, route.Path) {
+			r.URL.Path = strings.TrimPrefix(r.URL.Path, route.Path)
+			if r.URL.Path == "" {
+				r.URL.Path = "/"
+			}
+		}
+		slog.DebugContext(r.Context(), "默认路由处理请求", "route", route.Name, "method", r.Method, "path", r.URL.Path, "upstream", route.Target)
+		proxyHandler.ServeHTTP(w, r)
+	})
+
+	state.casProvider, state.casConfig = casProvider, cfg.CAS
+
+	// 应用认证中间件，IP访问规则和维护模式在认证之前检查
+	return ipFilter.Handler(maint.Handler(authMiddleware.Handler(mux))), nil
+
+}
@@ -4,7 +4,11 @@ go 1.21
 
 require (
 	github.com/gorilla/sessions v1.2.2
+	golang.org/x/net v0.35.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
-require github.com/gorilla/securecookie v1.1.2 // indirect
+require (
+	github.com/gorilla/securecookie v1.1.2 // indirect
+	golang.org/x/text v0.22.0 // indirect
+)
@@ -0,0 +1,88 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"cas-gateway/models"
+	"cas-gateway/reqinfo"
+)
+
+// Setup 根据配置初始化全局 slog 日志并输出到 w，同时将标准库 log 的输出重定向到 slog
+func Setup(cfg models.LogConfig, w io.Writer) error {
+	logger, err := New(cfg, w)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+	return nil
+}
+
+// New 创建结构化日志记录器
+func New(cfg models.LogConfig, w io.Writer) (*slog.Logger, error) {
+	level, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(cfg.Format) {
+	case "", "text":
+		handler = slog.NewTextHandler(w, opts)
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("日志格式无效: %q（可选值 text、json）", cfg.Format)
+	}
+	return slog.New(contextHandler{handler}), nil
+}
+
+// contextHandler 从 context 中提取请求ID和追踪ID加入每条日志（需使用 slog.InfoContext 等带 context 的方法）
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if info := reqinfo.FromContext(ctx); info != nil {
+		if info.RequestID != "" {
+			r.AddAttrs(slog.String("request_id", info.RequestID))
+		}
+		if info.TraceID != "" {
+			r.AddAttrs(slog.String("trace_id", info.TraceID))
+		}
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// ParseLevel 解析日志级别，空字符串默认为 info
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return slog.LevelInfo, fmt.Errorf("日志级别无效: %q（可选值 debug、info、warn、error）", s)
+}
+
+// Fatal 记录错误日志并退出进程
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
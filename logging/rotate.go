@@ -0,0 +1,130 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// RotatingFile 按大小滚动的日志文件
+// 当前文件写满后依次重命名为 path.1、path.2 ...，超过 maxBackups 的最旧文件会被删除
+type RotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu     sync.Mutex
+	file   *os.File // 滚动后重新打开失败时为 nil，下次写入时重试
+	size   int64
+	closed bool
+}
+
+// NewRotatingFile 打开（追加）日志文件，maxSize 为单个文件字节数上限，<=0 表示不滚动
+func NewRotatingFile(path string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	rf := &RotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *RotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("打开日志文件失败: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("读取日志文件信息失败: %w", err)
+	}
+	rf.file = f
+	rf.size = info.Size()
+	return nil
+}
+
+// Write 写入日志，写入前检查是否需要滚动
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.closed {
+		return 0, os.ErrClosed
+	}
+	if rf.file == nil {
+		if err := rf.open(); err != nil {
+			return 0, err
+		}
+	}
+	if rf.maxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		if err := rf.rotate(); err != nil {
+			// 滚动失败时继续写入原文件，写满 maxSize 后再次尝试，避免日志从此中断；
+			// 日志本身可能就写在该文件中，告警输出到标准错误
+			fmt.Fprintf(os.Stderr, "日志文件滚动失败，继续写入 %s: %v\n", rf.path, err)
+			if rf.file == nil {
+				return 0, err
+			}
+			rf.size = 0
+		}
+	}
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// rotate 关闭当前文件并依次重命名历史文件，无论重命名是否成功都重新打开 path；
+// 返回错误且 rf.file 不为 nil 时表示没有滚动成功，但仍可继续写入原文件
+func (rf *RotatingFile) rotate() error {
+	var errs []error
+	if err := rf.file.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("关闭日志文件失败: %w", err))
+	}
+	rf.file = nil
+
+	if rf.maxBackups > 0 {
+		os.Remove(fmt.Sprintf("%s.%d", rf.path, rf.maxBackups))
+		for i := rf.maxBackups - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", rf.path, i), fmt.Sprintf("%s.%d", rf.path, i+1))
+		}
+		if err := os.Rename(rf.path, rf.path+".1"); err != nil {
+			errs = append(errs, fmt.Errorf("滚动日志文件失败: %w", err))
+		}
+	} else if err := os.Truncate(rf.path, 0); err != nil {
+		errs = append(errs, fmt.Errorf("清空日志文件失败: %w", err))
+	}
+	if err := rf.open(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// Close 关闭日志文件
+func (rf *RotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	rf.closed = true
+	if rf.file == nil {
+		return nil
+	}
+	err := rf.file.Close()
+	rf.file = nil
+	return err
+}
+
+// nopCloser 标准输出不需要关闭
+type nopCloser struct{ *os.File }
+
+func (nopCloser) Close() error { return nil }
+
+// OpenOutput 打开日志输出：stdout/stderr 或文件路径（按 maxSizeMB 滚动，保留 maxBackups 个历史文件）
+func OpenOutput(output string, maxSizeMB, maxBackups int) (io.WriteCloser, error) {
+	switch output {
+	case "", "stdout":
+		return nopCloser{os.Stdout}, nil
+	case "stderr":
+		return nopCloser{os.Stderr}, nil
+	}
+	return NewRotatingFile(output, int64(maxSizeMB)*1024*1024, maxBackups)
+}
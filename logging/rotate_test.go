@@ -0,0 +1,98 @@
+package logging
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestRotatingFileRotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	rf, err := NewRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+	for _, line := range []string{"aaaaaaaa\n", "bbbbbbbb\n", "cccccccc\n", "dddddddd\n"} {
+		if _, err := rf.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 超过 maxBackups 的最旧文件被删除
+	if got := readFile(t, path); got != "dddddddd\n" {
+		t.Errorf("当前文件 = %q", got)
+	}
+	if got := readFile(t, path+".1"); got != "cccccccc\n" {
+		t.Errorf(".1 = %q", got)
+	}
+	if got := readFile(t, path+".2"); got != "bbbbbbbb\n" {
+		t.Errorf(".2 = %q", got)
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf(".3 不应存在: %v", err)
+	}
+}
+
+func TestRotatingFileKeepsWritingWhenRotateFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	// path.1 为非空目录，重命名当前文件必然失败
+	if err := os.MkdirAll(filepath.Join(path+".1", "x"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	rf, err := NewRotatingFile(path, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+
+	stderr := os.Stderr
+	os.Stderr, _ = os.Open(os.DevNull)
+	defer func() { os.Stderr = stderr }()
+
+	for _, line := range []string{"aaaaaaaa\n", "bbbbbbbb\n", "cccccccc\n"} {
+		if _, err := rf.Write([]byte(line)); err != nil {
+			t.Fatalf("滚动失败后写入出错: %v", err)
+		}
+	}
+	if got := readFile(t, path); got != "aaaaaaaa\nbbbbbbbb\ncccccccc\n" {
+		t.Errorf("滚动失败时应继续写入原文件，得到 %q", got)
+	}
+
+	// 故障排除后恢复滚动
+	if err := os.RemoveAll(path + ".1"); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"dddddddd\n", "eeeeeeee\n"} {
+		if _, err := rf.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := readFile(t, path); got != "eeeeeeee\n" {
+		t.Errorf("恢复后当前文件 = %q", got)
+	}
+	if got := readFile(t, path+".1"); !strings.HasSuffix(got, "dddddddd\n") {
+		t.Errorf("恢复后 .1 = %q", got)
+	}
+}
+
+func TestRotatingFileClosed(t *testing.T) {
+	rf, err := NewRotatingFile(filepath.Join(t.TempDir(), "app.log"), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rf.Close()
+	if _, err := rf.Write([]byte("x\n")); !errors.Is(err, os.ErrClosed) {
+		t.Fatalf("关闭后写入错误 = %v，期望 %v", err, os.ErrClosed)
+	}
+}
@@ -1,142 +1,329 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
-	"regexp"
-	"strings"
-	"cas-gateway/auth"
-	"cas-gateway/auth/cas"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+	"cas-gateway/audit"
 	"cas-gateway/config"
+	"cas-gateway/logging"
+	"cas-gateway/metrics"
 	"cas-gateway/middleware"
-	"cas-gateway/proxy"
+	"cas-gateway/models"
+	"cas-gateway/netutil"
+	"cas-gateway/tlsutil"
+	"cas-gateway/tracing"
 )
 
-func main() {
-	// 加载配置
-	configPath := "config.yaml"
-	if len(os.Args) > 1 {
-		configPath = os.Args[1]
-	}
+// serveOptions serve 子命令参数
+type serveOptions struct {
+	configPath string
+	logFile    string // 日志输出文件，为空时输出到标准输出
+	pidFile    string // PID 文件，为空时不写入
+}
 
+// serve 启动网关，直到收到退出信号并完成优雅关闭
+func serve(opts serveOptions) {
+	// 加载配置
+	configPath := opts.configPath
 	cfg, err := config.LoadConfig(configPath)
 	if err != nil {
-		log.Fatalf("加载配置失败: %v", err)
+		logging.Fatal("加载配置失败", "path", configPath, "error", err)
 	}
 
-	log.Printf("配置加载成功，服务器端口: %d", cfg.Server.Port)
-	log.Printf("CAS服务器: %s", cfg.CAS.BaseURL)
-	log.Printf("路由配置: %s -> %s", cfg.Route.Path, cfg.Route.Target)
-
-	// 创建代理管理器
-	proxyManager, err := proxy.NewProxyManager(&cfg.Route)
+	// 初始化日志（配置验证时已检查级别和格式）
+	logOutput, err := logging.OpenOutput(opts.logFile, cfg.Log.MaxSizeMB, cfg.Log.MaxBackups)
 	if err != nil {
-		log.Fatalf("创建代理管理器失败: %v", err)
+		logging.Fatal("打开日志文件失败", "path", opts.logFile, "error", err)
+	}
+	defer logOutput.Close()
+	if err := logging.Setup(cfg.Log, logOutput); err != nil {
+		logging.Fatal("初始化日志失败", "error", err)
 	}
 
-	// 创建CAS认证提供者
-	var authProvider auth.Provider
-	authProvider, err = cas.NewCASProvider()
-	if err != nil {
-		log.Fatalf("创建CAS认证提供者失败: %v", err)
-	}
-
-	// 创建认证中间件
-	authMiddleware := middleware.NewAuthMiddleware(cfg.Server.SessionKey, proxyManager, authProvider)
-
-	// 创建HTTP处理器
-	mux := http.NewServeMux()
-
-	// 注册路由处理器（所有请求都转发到同一个后端）
-	proxyHandler := proxyManager.GetProxy()
-	route := proxyManager.GetRoute()
-	
-	// 如果配置了路径前缀，注册带路径前缀的路由
-	if route.Path != "" && route.Path != "/" {
-		// 注册带尾斜杠的路径（会匹配所有子路径）
-		mux.Handle(route.Path+"/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			log.Printf("[路由处理] 处理请求: %s %s (路由: %s)", r.Method, r.URL.Path, route.Path)
-			// 剥离路径前缀
-			r.URL.Path = strings.TrimPrefix(r.URL.Path, route.Path)
-			if r.URL.Path == "" {
-				r.URL.Path = "/"
-			}
-			proxyHandler.ServeHTTP(w, r)
-		}))
-
-		// 注册精确路径（用于匹配路径本身）
-		mux.Handle(route.Path, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			log.Printf("[路由处理] 处理请求: %s %s (路由: %s)", r.Method, r.URL.Path, route.Path)
-			r.URL.Path = "/"
-			proxyHandler.ServeHTTP(w, r)
-		}))
+	// PID 文件，退出时删除
+	if opts.pidFile != "" {
+		if err := os.WriteFile(opts.pidFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o644); err != nil {
+			logging.Fatal("写入PID文件失败", "path", opts.pidFile, "error", err)
+		}
+		defer os.Remove(opts.pidFile)
 	}
 
-	log.Printf("路由已注册: %s -> %s", route.Path, route.Target)
+	slog.Info("配置加载成功", "port", cfg.Server.Port, "cas", cfg.CAS.BaseURL,
+		"route", cfg.Route.Name, "path", cfg.Route.Path, "upstream", cfg.Route.Target)
+
+	// 认证审计日志
+	var auditor *audit.Logger
+	if cfg.Audit.Enabled {
+		auditor, err = audit.Open(cfg.Audit)
+		if err != nil {
+			logging.Fatal("打开审计日志失败", "error", err)
+		}
+		defer auditor.Close()
+		slog.Info("审计日志已启用", "path", cfg.Audit.Path, "hash_chain", cfg.Audit.HashChain)
+	}
 
-	// 健康检查端点
-	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, "OK")
+	// 构建网关处理器（路由、代理、认证），SIGHUP 时重新构建并原子替换
+	// 关闭阶段标记、维护模式开关和长连接登记在重载后保留
+	state := &gatewayState{
+		auditor:     auditor,
+		maintenance: middleware.NewMaintenanceState(),
+		streams:     middleware.NewStreamRegistry(),
+	}
+	gw, err := newGateway(cfg, state)
+	if err != nil {
+		logging.Fatal("创建网关失败", "error", err)
+	}
+	reloader := newReloader(configPath, cfg, gw, func(newCfg *models.Config) (http.Handler, error) {
+		return newGateway(newCfg, state)
 	})
+	var handler http.Handler = reloader
 
-	// 登出端点
-	mux.HandleFunc("/logout", func(w http.ResponseWriter, r *http.Request) {
-		authMiddleware.Logout(w, r)
-		// 构建登出URL（参考原代码逻辑）
-		service := r.Header.Get("Origin")
-		if service == "" {
-			service = r.Header.Get("Referer")
+	// 管理端点（独立端口，不经过认证）
+	var adminServer *http.Server
+	if cfg.Admin.Listen != "" {
+		adminServer = &http.Server{
+			Addr:              cfg.Admin.Listen,
+			Handler:           newAdminHandler(cfg.Admin, state.maintenance, reloader.Config),
+			ReadHeaderTimeout: 10 * time.Second,
 		}
-		if service == "" {
-			scheme := "http"
-			if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
-				scheme = "https"
+		go func() {
+			slog.Info("管理端点已启动", "listen", cfg.Admin.Listen)
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logging.Fatal("管理端点启动失败", "error", err)
 			}
-			service = fmt.Sprintf("%s://%s", scheme, r.Host)
-		}
-		// 提取service参数（参考原代码）
-		if match := regexp.MustCompile(`\?service=(.*)`).FindStringSubmatch(service); len(match) > 1 {
-			service = match[1]
+		}()
+	}
+
+	// Prometheus 指标
+	var metricsServer *http.Server
+	if cfg.Metrics.Enabled {
+		handler = middleware.MetricsHandler(handler)
+
+		metricsHandler := metrics.Handler()
+		if cfg.Metrics.Listen != "" {
+			metricsMux := http.NewServeMux()
+			metricsMux.Handle(cfg.Metrics.Path, metricsHandler)
+			metricsServer = &http.Server{
+				Addr:              cfg.Metrics.Listen,
+				Handler:           metricsMux,
+				ReadHeaderTimeout: 10 * time.Second,
+			}
+			go func() {
+				slog.Info("指标端点已启动", "listen", cfg.Metrics.Listen, "path", cfg.Metrics.Path)
+				if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					logging.Fatal("指标端点启动失败", "error", err)
+				}
+			}()
+		} else {
+			gatewayHandler := handler
+			handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// 指标端点不经过认证
+				if r.URL.Path == cfg.Metrics.Path {
+					metricsHandler.ServeHTTP(w, r)
+					return
+				}
+				gatewayHandler.ServeHTTP(w, r)
+			})
+			slog.Info("指标端点已注册", "path", cfg.Metrics.Path)
 		}
-		logoutURL := fmt.Sprintf("%s/cas2/logout?service=%s", cfg.CAS.BaseURL, service)
-		log.Printf("[登出] 重定向到: %s", logoutURL)
-		http.Redirect(w, r, logoutURL, http.StatusFound)
-	})
+	}
 
-	// 添加通配符路由，处理所有未匹配的请求（如 /api/...、/static/... 等）
-	// 所有请求都转发到同一个后端服务
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		// 跳过已经注册的路径
-		if r.URL.Path == "/health" || r.URL.Path == "/logout" {
-			return
+	// 分布式追踪（在访问日志之外，使访问日志能记录追踪ID）
+	if cfg.Tracing.Enabled {
+		shutdownTracing, err := tracing.Setup(cfg.Tracing)
+		if err != nil {
+			logging.Fatal("初始化追踪失败", "error", err)
 		}
-		// 如果请求路径包含路由前缀，需要剥离前缀
-		if route.Path != "" && route.Path != "/" && strings.HasPrefix(r.URL.Path, route.Path) {
-			r.URL.Path = strings.TrimPrefix(r.URL.Path, route.Path)
-			if r.URL.Path == "" {
-				r.URL.Path = "/"
-			}
+		defer shutdownTracing(context.Background())
+		slog.Info("分布式追踪已启用", "exporter", cfg.Tracing.Exporter, "sample_ratio", cfg.Tracing.SampleRatio)
+	}
+
+	// 访问日志（包在认证和指标之外，记录完整的状态码、大小和耗时）
+	if cfg.AccessLog.Enabled {
+		accessLogger, err := middleware.NewAccessLogger(cfg.AccessLog)
+		if err != nil {
+			logging.Fatal("创建访问日志失败", "error", err)
 		}
-		log.Printf("[默认路由] 处理请求: %s %s -> %s", r.Method, r.URL.Path, route.Target)
-		proxyHandler.ServeHTTP(w, r)
-	})
+		defer accessLogger.Close()
+		handler = accessLogger.Handler(handler)
+	}
 
-	// 应用认证中间件
-	handler := authMiddleware.Handler(mux)
+	// 请求ID（最外层，保证访问日志和所有日志都能带上请求ID），其内解析可信代理转发的真实客户端信息
+	trustedProxies, err := netutil.ParseIPSet(cfg.Server.TrustedProxies)
+	if err != nil {
+		logging.Fatal("解析可信代理失败", "error", err)
+	}
+	if cfg.Tracing.Enabled {
+		handler = middleware.Tracing(handler)
+	}
+	// Host 头不合法时使用 route.public_url 的主机名（随配置重载）
+	publicHost := func() string {
+		if u, err := url.Parse(reloader.Config().Route.PublicURL); err == nil {
+			return u.Host
+		}
+		return ""
+	}
+	handler = middleware.Forwarded(trustedProxies, publicHost, handler)
+	handler = middleware.RequestID(trustedProxies, handler)
 
 	// 启动服务器
 	addr := fmt.Sprintf(":%d", cfg.Server.Port)
-	log.Printf("CAS Gateway 启动在端口 %d", cfg.Server.Port)
-	if route.Path != "" && route.Path != "/" {
-		log.Printf("访问 http://localhost%s%s 开始使用", addr, route.Path)
+	scheme := "http"
+	if cfg.Server.TLS.Enabled {
+		scheme = "https"
+	}
+	entry := fmt.Sprintf("%s://localhost%s", scheme, addr)
+	if cfg.Route.Path != "" && cfg.Route.Path != "/" {
+		entry += cfg.Route.Path
+	}
+	slog.Info("CAS Gateway 启动", "port", cfg.Server.Port, "url", entry)
+
+	errorLog := slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn)
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 30 * time.Second,
+		ErrorLog:          errorLog,
+	}
+	// Shutdown 不等待已升级的 WebSocket 连接，SSE 请求则会一直阻塞到超时，关闭时主动断开所有长连接
+	srv.RegisterOnShutdown(state.streams.CloseAll)
+	stopWatch := make(chan struct{})
+	defer close(stopWatch)
+	serveErr := make(chan error, 1)
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		logging.Fatal("服务器启动失败", "error", err)
+	}
+	// 四层负载均衡器后从 PROXY 协议头获取客户端地址
+	if pp := cfg.Server.ProxyProtocol; pp.Enabled {
+		allowed, err := netutil.ParseIPSet(pp.AllowedCIDRs)
+		if err != nil {
+			logging.Fatal("解析 PROXY 协议来源地址失败", "error", err)
+		}
+		ln = netutil.NewProxyListener(ln, allowed, pp.HeaderTimeout)
+		slog.Info("PROXY 协议已启用", "allowed_cidrs", pp.AllowedCIDRs)
+	}
+
+	// HTTPS：证书由 CertStore 按 SNI 提供，证书文件变化时自动重新加载
+	var certStore *tlsutil.CertStore
+	var redirectServer *http.Server
+	if cfg.Server.TLS.Enabled {
+		srv.TLSConfig, certStore, err = tlsutil.ServerConfig(&cfg.Server.TLS)
+		if err != nil {
+			logging.Fatal("初始化TLS失败", "error", err)
+		}
+		go certStore.Watch(cfg.Server.TLS.ReloadInterval, stopWatch)
+		go func() {
+			serveErr <- srv.ServeTLS(ln, "", "")
+		}()
+
+		if port := cfg.Server.TLS.HTTPRedirectPort; port > 0 {
+			redirectServer = &http.Server{
+				Addr:              fmt.Sprintf(":%d", port),
+				Handler:           httpsRedirect(cfg.Server.Port),
+				ReadHeaderTimeout: 10 * time.Second,
+				ErrorLog:          errorLog,
+			}
+			go func() {
+				slog.Info("HTTP跳转HTTPS已启动", "port", port)
+				if err := redirectServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					serveErr <- err
+				}
+			}()
+		}
 	} else {
-		log.Printf("访问 http://localhost%s 开始使用", addr)
+		go func() {
+			serveErr <- srv.Serve(ln)
+		}()
 	}
 
-	if err := http.ListenAndServe(addr, handler); err != nil {
-		log.Fatalf("服务器启动失败: %v", err)
+	// 可选：监听配置文件变更自动重载
+	if cfg.Server.WatchConfig {
+		go reloader.Watch(stopWatch)
 	}
+
+	// 等待信号：SIGHUP 重新加载配置，SIGTERM/SIGINT 退出（systemd stop 发送 SIGTERM）
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	var sig os.Signal
+wait:
+	for {
+		select {
+		case err := <-serveErr:
+			logging.Fatal("服务器启动失败", "error", err)
+		case sig = <-signals:
+			if sig != syscall.SIGHUP {
+				break wait
+			}
+			slog.Info("收到 SIGHUP，重新加载配置", "path", configPath)
+			if err := reloader.Reload(); err != nil {
+				slog.Error("配置重新加载失败，继续使用旧配置", "error", err)
+			}
+			if certStore != nil {
+				if err := certStore.Reload(); err != nil {
+					slog.Error("重新加载证书失败，继续使用旧证书", "error", err)
+				}
+			}
+		}
+	}
+
+	// 先让 /health 返回503，等待负载均衡器摘除流量，期间继续正常处理请求；再次收到信号则跳过等待
+	slog.Info("收到退出信号，开始优雅关闭", "signal", sig.String(),
+		"pre_stop_delay", cfg.Server.PreStopDelay.String(), "shutdown_timeout", cfg.Server.ShutdownTimeout.String())
+	state.draining.Store(true)
+	if cfg.Server.PreStopDelay > 0 {
+		select {
+		case <-time.After(cfg.Server.PreStopDelay):
+		case sig = <-signals:
+			slog.Warn("再次收到退出信号，跳过摘流等待", "signal", sig.String())
+		}
+	}
+
+	// 停止接受新连接，等待处理中的请求完成（最长 shutdown_timeout）
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Error("等待请求完成超时，强制关闭连接", "error", err)
+		srv.Close()
+	}
+	if metricsServer != nil {
+		metricsServer.Shutdown(ctx)
+	}
+	if redirectServer != nil {
+		redirectServer.Shutdown(ctx)
+	}
+	if adminServer != nil {
+		adminServer.Shutdown(ctx)
+	}
+	slog.Info("CAS Gateway 已退出")
+}
+
+// httpsRedirect 将 HTTP 请求永久跳转到相同主机的 HTTPS 端口
+func httpsRedirect(httpsPort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if httpsPort != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(httpsPort))
+		}
+		target := "https://" + host + r.URL.RequestURI()
+		// 只对 GET/HEAD 使用 301，其他方法用 308 保留请求方法和请求体
+		status := http.StatusMovedPermanently
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			status = http.StatusPermanentRedirect
+		}
+		http.Redirect(w, r, target, status)
+	})
 }
@@ -0,0 +1,45 @@
+package metrics
+
+import "runtime"
+
+// 网关指标定义
+var (
+	// HTTPRequests 请求计数（按路由、方法、状态码）
+	HTTPRequests = NewCounterVec("cas_gateway_http_requests_total",
+		"Total number of HTTP requests handled by the gateway.", "route", "method", "status")
+
+	// HTTPRequestDuration 请求处理延迟
+	HTTPRequestDuration = NewHistogramVec("cas_gateway_http_request_duration_seconds",
+		"HTTP request latency in seconds.", nil, "route", "method", "status")
+
+	// UpstreamErrors 反向代理转发失败次数
+	UpstreamErrors = NewCounterVec("cas_gateway_upstream_errors_total",
+		"Total number of errors returned by the reverse proxy when contacting upstreams.", "route")
+
+	// TicketValidations ticket 验证次数（result: success/failure）
+	TicketValidations = NewCounterVec("cas_gateway_ticket_validations_total",
+		"Total number of CAS ticket validation attempts.", "result")
+
+	// TicketValidationFailures ticket 验证失败次数（按CAS错误码）
+	TicketValidationFailures = NewCounterVec("cas_gateway_ticket_validation_failures_total",
+		"Total number of failed CAS ticket validations by CAS error code.", "code")
+
+	// TicketValidationDuration ticket 验证延迟
+	TicketValidationDuration = NewHistogramVec("cas_gateway_ticket_validation_duration_seconds",
+		"CAS ticket validation latency in seconds.", nil)
+
+	// LoginRedirects 跳转CAS登录次数（mode: login/renew/gateway）
+	LoginRedirects = NewCounterVec("cas_gateway_login_redirects_total",
+		"Total number of redirects to the CAS login page.", "mode")
+
+	// RateLimitRequests 限流规则检查次数（rule: <key>:<path>，result: allowed/limited）
+	RateLimitRequests = NewCounterVec("cas_gateway_rate_limit_requests_total",
+		"Total number of requests checked against rate limit rules.", "route", "rule", "result")
+
+	// CASCircuitState CAS熔断器状态（0 关闭，1 打开，2 半开）
+	CASCircuitState = NewGauge("cas_gateway_cas_circuit_state",
+		"State of the CAS circuit breaker (0 closed, 1 open, 2 half-open).")
+
+	_ = NewGaugeFunc("cas_gateway_goroutines",
+		"Number of goroutines that currently exist.", func() float64 { return float64(runtime.NumGoroutine()) })
+)
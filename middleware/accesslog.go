@@ -0,0 +1,166 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"text/template"
+	"time"
+	"cas-gateway/logging"
+	"cas-gateway/models"
+	"cas-gateway/reqinfo"
+)
+
+// AccessLogEntry 一条访问日志，也是自定义模板可用的字段
+type AccessLogEntry struct {
+	Time       time.Time `json:"time"`
+	RequestID  string    `json:"request_id,omitempty"`
+	TraceID    string    `json:"trace_id,omitempty"`
+	RemoteAddr string    `json:"remote_addr"`
+	User       string    `json:"user"`
+	Route      string    `json:"route"`
+	Method     string    `json:"method"`
+	URI        string    `json:"uri"`
+	Path       string    `json:"path"`
+	Proto      string    `json:"proto"`
+	Host       string    `json:"host"`
+	Status     int       `json:"status"`
+	Size       int64     `json:"size"`
+	Referer    string    `json:"referer"`
+	UserAgent  string    `json:"user_agent"`
+	Upstream   string    `json:"upstream,omitempty"`
+
+	DurationMS         float64 `json:"duration_ms"`
+	UpstreamDurationMS float64 `json:"upstream_duration_ms,omitempty"`
+}
+
+// AccessLogger 访问日志中间件，在响应完成后记录状态码、大小和耗时
+type AccessLogger struct {
+	format string
+	tmpl   *template.Template
+	out    io.WriteCloser
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+// NewAccessLogger 创建访问日志中间件
+func NewAccessLogger(cfg models.AccessLogConfig) (*AccessLogger, error) {
+	al := &AccessLogger{format: cfg.Format}
+	switch cfg.Format {
+	case "", "combined":
+		al.format = "combined"
+	case "common", "json":
+	case "template":
+		tmpl, err := template.New("access_log").Parse(cfg.Template)
+		if err != nil {
+			return nil, fmt.Errorf("解析访问日志模板失败: %w", err)
+		}
+		al.tmpl = tmpl
+	default:
+		return nil, fmt.Errorf("访问日志格式无效: %q（可选值 combined、common、json、template）", cfg.Format)
+	}
+
+	out, err := logging.OpenOutput(cfg.Output, cfg.MaxSizeMB, cfg.MaxBackups)
+	if err != nil {
+		return nil, err
+	}
+	al.out = out
+	return al, nil
+}
+
+// Handler 访问日志处理函数
+func (al *AccessLogger) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := reqinfo.FromContext(r.Context())
+		if info == nil {
+			var ctx context.Context
+			ctx, info = reqinfo.NewContext(r.Context())
+			r = r.WithContext(ctx)
+		}
+		rec := newResponseRecorder(w)
+
+		// 后续处理会改写 r.URL.Path（剥离路由前缀），先保存原始请求信息
+		entry := AccessLogEntry{
+			Time:       info.Start,
+			RequestID:  info.RequestID,
+			TraceID:    info.TraceID,
+			RemoteAddr: clientIP(r),
+			Method:     r.Method,
+			URI:        r.RequestURI,
+			Path:       r.URL.Path,
+			Proto:      r.Proto,
+			Host:       r.Host,
+			Referer:    r.Referer(),
+			UserAgent:  r.UserAgent(),
+		}
+
+		next.ServeHTTP(rec, r)
+
+		entry.Status = rec.Status()
+		entry.Size = rec.Size()
+		entry.User = info.User
+		entry.Route = info.Route
+		entry.Upstream = info.Upstream
+		entry.DurationMS = durationMS(time.Since(info.Start))
+		entry.UpstreamDurationMS = durationMS(info.UpstreamDuration)
+		al.write(&entry)
+	})
+}
+
+// write 格式化并输出一条日志，各格式均以换行结尾
+func (al *AccessLogger) write(e *AccessLogEntry) {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+
+	al.buf.Reset()
+	switch al.format {
+	case "json":
+		json.NewEncoder(&al.buf).Encode(e)
+	case "template":
+		if err := al.tmpl.Execute(&al.buf, e); err != nil {
+			fmt.Fprintf(&al.buf, "访问日志模板执行失败: %v", err)
+		}
+		if b := al.buf.Bytes(); len(b) == 0 || b[len(b)-1] != '\n' {
+			al.buf.WriteByte('\n')
+		}
+	default:
+		// Common Log Format: host ident authuser [date] "request" status bytes
+		fmt.Fprintf(&al.buf, "%s - %s [%s] \"%s %s %s\" %d %s",
+			e.RemoteAddr, dashIfEmpty(e.User), e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+			e.Method, e.URI, e.Proto, e.Status, clfSize(e.Size))
+		if al.format == "combined" {
+			fmt.Fprintf(&al.buf, " %q %q", e.Referer, e.UserAgent)
+		}
+		al.buf.WriteByte('\n')
+	}
+	al.out.Write(al.buf.Bytes())
+}
+
+// Close 关闭日志输出
+func (al *AccessLogger) Close() error {
+	return al.out.Close()
+}
+
+func durationMS(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func clfSize(n int64) string {
+	if n == 0 {
+		return "-"
+	}
+	return strconv.FormatInt(n, 10)
+}
@@ -1,12 +1,24 @@
 package middleware
 
 import (
-	"log"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
 	"regexp"
 	"strings"
+	"time"
+	"cas-gateway/audit"
 	"cas-gateway/auth"
+	"cas-gateway/metrics"
+	"cas-gateway/models"
+	"cas-gateway/pages"
 	"cas-gateway/proxy"
+	"cas-gateway/reqinfo"
+	"cas-gateway/tracing"
 
 	"github.com/gorilla/sessions"
 )
@@ -15,8 +27,14 @@ const (
 	SessionName        = "cas_gateway_session"
 	UserKey            = "user"
 	IsAuthenticatedKey = "authenticated"
+	AuthTimeKey        = "authTime" // 最近一次在CAS输入凭证的时间（Unix秒）
+	SessionIDKey       = "sid"      // 会话标识，登录时生成，用于登出时关闭该会话的长连接
+	RenewedKey         = "renewed"  // 刚通过重新认证的规则路径，回跳后的下一次请求放行一次（max_age 为 0 时避免循环跳转）
 )
 
+// errSession ticket 验证成功但建立会话失败（生成会话标识、保存session），返回500而不是重新跳转登录
+var errSession = errors.New("建立会话失败")
+
 var (
 	// staticFileRegex 静态文件扩展名正则表达式（参考原 Node.js 版本）
 	staticFileRegex = regexp.MustCompile(`\.(ico|jpg|jpeg|png|gif|svg|js|css|swf|eot|ttf|otf|woff|woff2)$`)
@@ -27,21 +45,55 @@ func isStaticFile(path string) bool {
 	return staticFileRegex.MatchString(path)
 }
 
+// hasPathPrefix 按路径段判断前缀匹配（/a 匹配 /a 和 /a/b，不匹配 /ab）
+func hasPathPrefix(path, prefix string) bool {
+	if prefix == "" || prefix == "/" {
+		return true
+	}
+	prefix = strings.TrimSuffix(prefix, "/")
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// stripRoutePrefix 剥离请求路径中的路由前缀
+func stripRoutePrefix(r *http.Request, route *models.RouteConfig) {
+	if route.Path != "" && route.Path != "/" && strings.HasPrefix(r.URL.Path, route.Path) {
+		r.URL.Path = strings.TrimPrefix(r.URL.Path, route.Path)
+		if r.URL.Path == "" {
+			r.URL.Path = "/"
+		}
+	}
+}
+
+// clientIP 获取客户端IP：优先使用 Forwarded 中间件按可信代理解析的真实IP，否则为对端地址（去除端口）
+func clientIP(r *http.Request) string {
+	if info := reqinfo.FromContext(r.Context()); info != nil && info.ClientIP != "" {
+		return info.ClientIP
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 // AuthMiddleware 认证中间件
 type AuthMiddleware struct {
 	store        *sessions.CookieStore
 	proxyManager *proxy.ProxyManager
 	authProvider auth.Provider
+	auditor      *audit.Logger
+	streams      *StreamRegistry
+	pages        *pages.Set
 }
 
-// NewAuthMiddleware 创建认证中间件
-func NewAuthMiddleware(sessionKey string, pm *proxy.ProxyManager, authProvider auth.Provider) *AuthMiddleware {
-	store := sessions.NewCookieStore([]byte(sessionKey))
+// NewAuthMiddleware 创建认证中间件，auditor 为 nil 时不记录审计日志
+func NewAuthMiddleware(server *models.ServerConfig, pm *proxy.ProxyManager, authProvider auth.Provider, auditor *audit.Logger, streams *StreamRegistry, pageSet *pages.Set) *AuthMiddleware {
+	store := sessions.NewCookieStore([]byte(server.SessionKey))
 	store.Options = &sessions.Options{
 		Path:     "/",
 		MaxAge:   86400 * 7, // 7天
 		HttpOnly: true,
-		Secure:   false, // 在生产环境建议设为true（HTTPS）
+		Secure:   server.TLS.Enabled, // 网关直接监听HTTPS时只通过HTTPS发送会话Cookie
 		SameSite: http.SameSiteLaxMode,
 	}
 
@@ -49,6 +101,9 @@ func NewAuthMiddleware(sessionKey string, pm *proxy.ProxyManager, authProvider a
 		store:        store,
 		proxyManager: pm,
 		authProvider: authProvider,
+		auditor:      auditor,
+		streams:      streams,
+		pages:        pageSet,
 	}
 }
 
@@ -56,7 +111,7 @@ func NewAuthMiddleware(sessionKey string, pm *proxy.ProxyManager, authProvider a
 func (am *AuthMiddleware) Handler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// 打印请求日志
-		log.Printf("[请求] %s %s %s", r.Method, r.URL.Path, r.RemoteAddr)
+		slog.DebugContext(r.Context(), "收到请求", "method", r.Method, "path", r.URL.Path, "remote_addr", r.RemoteAddr)
 
 		// 特殊路径直接处理（不转发到后端）
 		if r.URL.Path == "/health" || r.URL.Path == "/logout" {
@@ -67,78 +122,103 @@ func (am *AuthMiddleware) Handler(next http.Handler) http.Handler {
 		// 获取路由配置（单个路由，所有请求都转发到同一个后端）
 		route := am.proxyManager.GetRoute()
 		if route == nil {
-			log.Printf("[路由] 路由配置不存在")
-			http.NotFound(w, r)
+			slog.ErrorContext(r.Context(), "路由配置不存在", "path", r.URL.Path)
+			am.pages.Error(w, r, http.StatusNotFound)
 			return
 		}
+		reqinfo.SetRoute(r.Context(), route.Name)
 
 		// 静态文件直接转发到后端系统，不进行认证检查（参考原 Node.js 版本的逻辑）
 		if isStaticFile(r.URL.Path) {
-			log.Printf("[静态文件] 直接转发: %s -> %s", r.URL.Path, route.Target)
+			slog.DebugContext(r.Context(), "静态文件直接转发", "route", route.Name, "path", r.URL.Path, "upstream", route.Target)
 			// 直接使用代理转发，不剥离路径前缀
 			proxy := am.proxyManager.GetProxy()
 			proxy.ServeHTTP(w, r)
 			return
 		}
 
-		// 获取session
-		session, _ := am.store.Get(r, SessionName)
+		// 获取session（Cookie存在但无法解码说明已过期或密钥已更换）
+		_, span := tracing.Start(r.Context(), "session.lookup", tracing.SpanKindInternal)
+		session, err := am.store.Get(r, SessionName)
+		span.SetAttr("session.new", session.IsNew)
+		span.SetError(err)
+		span.End()
+		if err != nil {
+			am.expireSession(w, r, route, err)
+		}
 
 		// 检查是否已认证（参考原代码：检查cookie中的token）
 		authenticated, ok := session.Values[IsAuthenticatedKey].(bool)
 		if ok && authenticated {
+			// 敏感路径要求近期输入过密码，否则强制CAS重新认证（renew=true）
+			if rule := matchRenewRule(route, r.URL.Path); rule != nil {
+				if am.handleRenew(w, r, session, rule) {
+					return
+				}
+			}
 			// 已认证，继续处理（参考原代码：设置请求头并转发）
 			user := am.GetUser(r)
+			reqinfo.SetUser(r.Context(), user)
 			if user != "" {
 				r.Header.Set("X-User", user)
 				if employeeName, ok := session.Values["employeeName"].(string); ok && employeeName != "" {
 					r.Header.Set("X-Employee-Name", employeeName)
 				}
 			}
-			log.Printf("[认证] 已认证用户: %s, 转发请求: %s", user, r.URL.Path)
-			// 如果请求路径包含路由前缀，需要剥离前缀
-			if route.Path != "" && route.Path != "/" && strings.HasPrefix(r.URL.Path, route.Path) {
-				r.URL.Path = strings.TrimPrefix(r.URL.Path, route.Path)
-				if r.URL.Path == "" {
-					r.URL.Path = "/"
-				}
+			slog.DebugContext(r.Context(), "已认证用户，转发请求", "route", route.Name, "user", user, "method", r.Method, "path", r.URL.Path)
+			// WebSocket/SSE 长连接：登记到会话，登出时关闭，并设置空闲超时
+			if isStream(r) {
+				var done func()
+				w, r, done = am.streams.trackStream(w, r, streamKey(session.Values), streamIdleTimeout(route))
+				defer done()
 			}
+			// 如果请求路径包含路由前缀，需要剥离前缀
+			stripRoutePrefix(r, route)
 			next.ServeHTTP(w, r)
 			return
 		}
 
+		// 可选认证路径：通过CAS网关模式探测SSO会话，没有则匿名访问
+		if isOptionalAuth(route, r.URL.Path) {
+			am.handleOptional(w, r, next, session, route)
+			return
+		}
+
 		// 检查是否为登录回调（包含ticket）
 		if am.authProvider.IsLoginPath(r.URL.String()) {
-			ticket, err := am.authProvider.ExtractTicket(r.URL.String())
+			// 验证ticket（使用路由路径构建service URL）
+			servicePath := route.Path
+			if servicePath == "" {
+				servicePath = "/"
+			}
+			serviceURL := am.serviceURL(r, servicePath)
+			userInfo, err := am.login(w, r, session, serviceURL, auth.LoginOptions{})
 			if err == nil {
-				// 验证ticket（使用路由路径构建service URL）
-				servicePath := route.Path
-				if servicePath == "" {
-					servicePath = "/"
-				}
-				serviceURL := am.authProvider.BuildServiceURL(r, servicePath)
-				userInfo, err := am.authProvider.ValidateTicket(ticket, serviceURL)
-				if err == nil {
-					// 验证成功，保存session（使用oaid作为用户标识）
-					session.Values[UserKey] = userInfo.Oaid
-					if userInfo.EmployeeName != "" {
-						session.Values["employeeName"] = userInfo.EmployeeName
-					}
-					session.Values[IsAuthenticatedKey] = true
-					if err := session.Save(r, w); err == nil {
-						// 重定向到路由路径（去除ticket参数）
-						redirectPath := servicePath
-						if redirectPath == "/" {
-							redirectPath = ""
-						}
-						log.Printf("[认证] 认证成功，重定向到: %s", redirectPath)
-						http.Redirect(w, r, redirectPath, http.StatusFound)
-						return
-					}
-				} else {
-					log.Printf("[认证] Ticket验证失败: %v", err)
+				// 重定向到路由路径（去除ticket参数）
+				redirectPath := servicePath
+				if redirectPath == "/" {
+					redirectPath = ""
 				}
+				slog.InfoContext(r.Context(), "认证成功", "route", route.Name, "user", userInfo.Oaid, "redirect", redirectPath)
+				http.Redirect(w, r, redirectPath, http.StatusFound)
+				return
+			}
+			if am.sessionFailed(w, r, err) {
+				return
 			}
+			slog.WarnContext(r.Context(), "ticket验证失败", "route", route.Name, "path", r.URL.Path, "error", err)
+		}
+
+		// WebSocket/SSE 请求无法跟随跳转到登录页，返回401由前端处理（如刷新页面重新登录）
+		if isStream(r) {
+			am.rejectStream(w, r)
+			return
+		}
+
+		// CAS不可用（熔断）时不跳转到无法访问的登录页，已登录用户不受影响
+		if ok, retryAfter := am.authProvider.Available(); !ok {
+			am.loginUnavailable(w, r, retryAfter)
+			return
 		}
 
 		// 未认证，跳转到登录页（参考原代码逻辑）
@@ -146,13 +226,181 @@ func (am *AuthMiddleware) Handler(next http.Handler) http.Handler {
 		if servicePath == "" {
 			servicePath = "/"
 		}
-		serviceURL := am.authProvider.BuildServiceURL(r, servicePath)
-		loginURL := am.authProvider.GetLoginURL(serviceURL)
-		log.Printf("[认证] 未认证，跳转到登录页: %s", loginURL)
+		serviceURL := am.serviceURL(r, servicePath)
+		loginURL := am.authProvider.GetLoginURL(serviceURL, auth.LoginOptions{})
+		slog.DebugContext(r.Context(), "未认证，跳转到登录页", "route", route.Name, "path", r.URL.Path, "login_url", loginURL)
+		metrics.LoginRedirects.Inc("login")
 		http.Redirect(w, r, loginURL, http.StatusFound)
 	})
 }
 
+// serviceURL 构建CAS service 地址，配置了 route.public_url 时使用固定的对外地址，避免受请求 Host 头影响
+func (am *AuthMiddleware) serviceURL(r *http.Request, path string) string {
+	if public := am.proxyManager.GetRoute().PublicURL; public != "" {
+		return strings.TrimSuffix(public, "/") + path
+	}
+	return am.authProvider.BuildServiceURL(r, path)
+}
+
+// handleRenew 处理敏感路径的强制重新认证，返回true表示已写出响应
+// service URL 使用当前请求路径（去除ticket），保证跳转和验证时一致，认证后回到原页面
+func (am *AuthMiddleware) handleRenew(w http.ResponseWriter, r *http.Request, session *sessions.Session, rule *models.RenewConfig) bool {
+	route := am.proxyManager.GetRoute()
+	servicePath := stripTicket(r)
+	serviceURL := am.serviceURL(r, servicePath)
+	opts := auth.LoginOptions{Renew: true}
+
+	if am.authProvider.IsLoginPath(r.URL.String()) {
+		session.Values[RenewedKey] = rule.Path
+		userInfo, err := am.login(w, r, session, serviceURL, opts)
+		if err == nil {
+			slog.InfoContext(r.Context(), "重新认证成功", "route", route.Name, "user", userInfo.Oaid, "redirect", servicePath)
+			http.Redirect(w, r, servicePath, http.StatusFound)
+			return true
+		}
+		if am.sessionFailed(w, r, err) {
+			return true
+		}
+		delete(session.Values, RenewedKey)
+		slog.WarnContext(r.Context(), "重新认证ticket验证失败", "route", route.Name, "path", r.URL.Path, "error", err)
+	} else if takeRenewed(w, r, session, rule) || !renewRequired(rule, sessionAuthTime(session.Values)) {
+		return false
+	}
+
+	if isStream(r) {
+		am.rejectStream(w, r)
+		return true
+	}
+
+	if ok, retryAfter := am.authProvider.Available(); !ok {
+		am.loginUnavailable(w, r, retryAfter)
+		return true
+	}
+
+	loginURL := am.authProvider.GetLoginURL(serviceURL, opts)
+	slog.InfoContext(r.Context(), "敏感路径需要重新认证，跳转到登录页", "route", route.Name, "path", r.URL.Path, "rule", rule.Path, "user", session.Values[UserKey])
+	metrics.LoginRedirects.Inc("renew")
+	http.Redirect(w, r, loginURL, http.StatusFound)
+	return true
+}
+
+// rejectStream 未认证（或需要重新认证）的长连接请求返回401
+func (am *AuthMiddleware) rejectStream(w http.ResponseWriter, r *http.Request) {
+	slog.DebugContext(r.Context(), "长连接请求未认证，返回401", "path", r.URL.Path, "upgrade", r.Header.Get("Upgrade"))
+	am.pages.Error(w, r, http.StatusUnauthorized)
+}
+
+// loginUnavailable 输出登录服务不可用页面
+func (am *AuthMiddleware) loginUnavailable(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	slog.WarnContext(r.Context(), "CAS不可用，无法跳转登录", "path", r.URL.Path, "retry_after", retryAfter.String())
+	am.pages.LoginUnavailable(w, r, retryAfter)
+}
+
+// login 验证回调请求中的ticket并建立会话，同时记录审计事件
+func (am *AuthMiddleware) login(w http.ResponseWriter, r *http.Request, session *sessions.Session, serviceURL string, opts auth.LoginOptions) (*auth.UserInfo, error) {
+	route := am.proxyManager.GetRoute()
+	ticket, err := am.authProvider.ExtractTicket(r.URL.String())
+	if err != nil {
+		return nil, err
+	}
+
+	userInfo, err := am.authProvider.ValidateTicket(r.Context(), ticket, serviceURL, opts)
+	if err != nil {
+		event := audit.Event{
+			Type:         audit.EventValidationFailed,
+			Route:        route.Name,
+			TicketPrefix: audit.TicketPrefix(ticket),
+			Reason:       err.Error(),
+		}
+		var verr *auth.ValidationError
+		if errors.As(err, &verr) {
+			event.Code = verr.Code
+		}
+		am.recordAudit(r, event)
+		return nil, err
+	}
+
+	// 验证成功，保存session（使用oaid作为用户标识）
+	// 同一用户重新认证（renew、可选认证路径）沿用原会话标识，已建立的长连接在登出时仍能关闭；首次登录或换了用户才生成新的
+	if sid, _ := session.Values[SessionIDKey].(string); sid == "" || session.Values[UserKey] != userInfo.Oaid {
+		sid, err := newSessionID()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errSession, err)
+		}
+		session.Values[SessionIDKey] = sid
+	}
+	session.Values[UserKey] = userInfo.Oaid
+	if userInfo.EmployeeName != "" {
+		session.Values["employeeName"] = userInfo.EmployeeName
+	}
+	session.Values[IsAuthenticatedKey] = true
+	session.Values[AuthTimeKey] = time.Now().Unix()
+	reqinfo.SetUser(r.Context(), userInfo.Oaid)
+	if err := session.Save(r, w); err != nil {
+		return nil, fmt.Errorf("%w: 保存session失败: %v", errSession, err)
+	}
+
+	am.recordAudit(r, audit.Event{
+		Type:         audit.EventLoginSuccess,
+		Oaid:         userInfo.Oaid,
+		Route:        route.Name,
+		TicketPrefix: audit.TicketPrefix(ticket),
+	})
+	return userInfo, nil
+}
+
+// recordAudit 补充客户端信息后写入审计日志
+func (am *AuthMiddleware) recordAudit(r *http.Request, e audit.Event) {
+	recordAudit(am.auditor, r, e)
+}
+
+// expireSession 记录会话过期事件并删除无法解码的会话Cookie，避免之后每个请求重复记录；
+// 本次请求继续按未登录处理，重新登录时设置的新Cookie在删除之后写出
+func (am *AuthMiddleware) expireSession(w http.ResponseWriter, r *http.Request, route *models.RouteConfig, err error) {
+	am.recordAudit(r, audit.Event{Type: audit.EventSessionExpired, Route: route.Name, Reason: err.Error()})
+	opts := *am.store.Options
+	opts.MaxAge = -1
+	http.SetCookie(w, sessions.NewCookie(SessionName, "", &opts))
+}
+
+// recordAudit 补充请求ID和客户端信息后写入审计日志，auditor 为 nil 时忽略
+func recordAudit(auditor *audit.Logger, r *http.Request, e audit.Event) {
+	e.RequestID = reqinfo.RequestID(r.Context())
+	e.ClientIP = clientIP(r)
+	e.UserAgent = r.UserAgent()
+	auditor.Log(e)
+}
+
+// newSessionID 生成随机会话标识
+func newSessionID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("生成会话标识失败: %w", err)
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+// sessionFailed 登录时建立会话失败则返回500，返回true表示已写出响应
+func (am *AuthMiddleware) sessionFailed(w http.ResponseWriter, r *http.Request, err error) bool {
+	if !errors.Is(err, errSession) {
+		return false
+	}
+	slog.ErrorContext(r.Context(), "ticket验证成功但建立会话失败", "path", r.URL.Path, "error", err)
+	am.pages.Error(w, r, http.StatusInternalServerError)
+	return true
+}
+
+// streamKey 返回长连接登记使用的会话标识；升级前创建的会话没有 sid，按用户登记
+func streamKey(values map[interface{}]interface{}) string {
+	if sid, ok := values[SessionIDKey].(string); ok && sid != "" {
+		return "sid:" + sid
+	}
+	if user, ok := values[UserKey].(string); ok && user != "" {
+		return "user:" + user
+	}
+	return ""
+}
+
 // GetUser 从请求中获取当前用户
 func (am *AuthMiddleware) GetUser(r *http.Request) string {
 	session, _ := am.store.Get(r, SessionName)
@@ -162,9 +410,15 @@ func (am *AuthMiddleware) GetUser(r *http.Request) string {
 	return ""
 }
 
-// Logout 登出
+// Logout 登出，同时关闭该会话的 WebSocket/SSE 连接
 func (am *AuthMiddleware) Logout(w http.ResponseWriter, r *http.Request) {
 	session, _ := am.store.Get(r, SessionName)
+	if user, ok := session.Values[UserKey].(string); ok && user != "" {
+		am.recordAudit(r, audit.Event{Type: audit.EventLogout, Oaid: user, Route: am.proxyManager.GetRoute().Name})
+		if n := am.streams.Close(streamKey(session.Values)); n > 0 {
+			slog.InfoContext(r.Context(), "登出，关闭会话的长连接", "user", user, "streams", n)
+		}
+	}
 	session.Values = make(map[interface{}]interface{})
 	session.Options.MaxAge = -1
 	session.Save(r, w)
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"cas-gateway/audit"
+	"cas-gateway/auth"
+	"cas-gateway/models"
+	"cas-gateway/proxy"
+)
+
+// hugeUserProvider 返回超长的用户名，会话 Cookie 超过大小限制导致保存失败
+type hugeUserProvider struct{ fakeProvider }
+
+func (hugeUserProvider) ValidateTicket(ctx context.Context, ticket, serviceURL string, opts auth.LoginOptions) (*auth.UserInfo, error) {
+	return &auth.UserInfo{Oaid: "alice", EmployeeName: strings.Repeat("x", 8192)}, nil
+}
+
+func TestLoginSessionFailureReturns500(t *testing.T) {
+	route := &models.RouteConfig{Name: "app", Path: "/app", Target: "http://127.0.0.1:1"}
+	pm, err := proxy.NewProxyManager(route, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &models.ServerConfig{SessionKey: strings.Repeat("k", 32)}
+	am := NewAuthMiddleware(server, pm, hugeUserProvider{}, nil, NewStreamRegistry(), nil)
+
+	w := httptest.NewRecorder()
+	am.Handler(pm.GetProxy()).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/app/?ticket=ST-ok", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("状态码 = %d，期望 500（Location %q）", w.Code, w.Header().Get("Location"))
+	}
+}
+
+func TestStaleSessionCookieExpired(t *testing.T) {
+	route := &models.RouteConfig{Name: "app", Path: "/app", Target: "http://127.0.0.1:1"}
+	pm, err := proxy.NewProxyManager(route, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "audit.log")
+	auditor, err := audit.Open(models.AuditConfig{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer auditor.Close()
+	server := &models.ServerConfig{SessionKey: strings.Repeat("k", 32)}
+	am := NewAuthMiddleware(server, pm, fakeProvider{}, auditor, NewStreamRegistry(), nil)
+
+	r := httptest.NewRequest(http.MethodGet, "/app/", nil)
+	r.Header.Set("Cookie", SessionName+"=stale")
+	w := httptest.NewRecorder()
+	am.Handler(pm.GetProxy()).ServeHTTP(w, r)
+
+	var deleted bool
+	for _, c := range w.Result().Cookies() {
+		if c.Name == SessionName && c.MaxAge < 0 && c.Path == "/" {
+			deleted = true
+		}
+	}
+	if !deleted {
+		t.Fatalf("无法解码的会话Cookie应被删除，Set-Cookie = %q", w.Header().Values("Set-Cookie"))
+	}
+	if w.Code != http.StatusFound {
+		t.Fatalf("状态码 = %d，期望跳转登录", w.Code)
+	}
+	b, _ := os.ReadFile(path)
+	if n := strings.Count(string(b), `"event":"session_expired"`); n != 1 {
+		t.Fatalf("session_expired 事件数 = %d，期望 1", n)
+	}
+	if !strings.Contains(string(b), `"route":"app"`) {
+		t.Fatalf("审计事件缺少路由: %s", b)
+	}
+}
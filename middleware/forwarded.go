@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"cas-gateway/netutil"
+	"cas-gateway/reqinfo"
+)
+
+// forwardedHeaders 代理转发头，只接受来自可信代理的值
+var forwardedHeaders = []string{"Forwarded", "X-Forwarded-For", "X-Forwarded-Proto", "X-Forwarded-Host", "X-Real-IP"}
+
+// Forwarded 解析真实客户端IP、协议和主机名并记录到请求信息中
+// 直接连接的对端在 trusted_proxies 中时才采用 Forwarded（优先）或 X-Forwarded-* 请求头，
+// 否则删除这些请求头，避免伪造的值被日志、限流、CAS service 地址和后端服务使用；
+// 请求的 Host 头不合法时改用 defaultHost 返回的主机名（如 route.public_url 的主机名），为空时使用网关监听的本地地址
+func Forwarded(trustedProxies netutil.IPSet, defaultHost func() string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := reqinfo.FromContext(r.Context())
+		if info == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		peer := netutil.RemoteIP(r.RemoteAddr)
+		info.ClientIP = r.RemoteAddr
+		if peer != nil {
+			info.ClientIP = peer.String()
+		}
+		info.Scheme = "http"
+		if r.TLS != nil {
+			info.Scheme = "https"
+		}
+		info.Host = r.Host
+		if !netutil.ValidHost(info.Host) {
+			info.Host = fallbackHost(r, defaultHost)
+		}
+
+		if !trustedProxies.Contains(peer) {
+			for _, h := range forwardedHeaders {
+				r.Header.Del(h)
+			}
+		} else if values := r.Header.Values("Forwarded"); len(values) > 0 {
+			resolveForwarded(info, trustedProxies, netutil.ParseForwarded(values))
+		} else {
+			resolveXForwarded(info, trustedProxies, r.Header)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// resolveForwarded 从右向左跳过可信代理，第一个不可信的节点为客户端，协议和主机名取该节点记录的值
+func resolveForwarded(info *reqinfo.Info, trustedProxies netutil.IPSet, elems []netutil.ForwardedElement) {
+	for i := len(elems) - 1; i >= 0; i-- {
+		e := elems[i]
+		ip := netutil.ParseNodeIP(e.For)
+		if ip != nil && trustedProxies.Contains(ip) && i > 0 {
+			continue
+		}
+		if ip != nil {
+			info.ClientIP = ip.String()
+		}
+		setSchemeHost(info, e.Proto, e.Host)
+		return
+	}
+}
+
+// resolveXForwarded 从右向左跳过可信代理得到客户端IP；协议和主机名只接受单个值，
+// 有多个值时无法区分哪个由可信代理设置（最左边的值可能来自客户端），忽略并使用连接本身的协议和主机名
+func resolveXForwarded(info *reqinfo.Info, trustedProxies netutil.IPSet, h http.Header) {
+	var chain []string
+	for _, v := range h.Values("X-Forwarded-For") {
+		chain = append(chain, strings.Split(v, ",")...)
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		ip := netutil.ParseNodeIP(chain[i])
+		if ip == nil {
+			// 无法解析的地址之前的部分不可信
+			break
+		}
+		info.ClientIP = ip.String()
+		if !trustedProxies.Contains(ip) {
+			break
+		}
+	}
+	setSchemeHost(info, singleValue(h, "X-Forwarded-Proto"), singleValue(h, "X-Forwarded-Host"))
+}
+
+// setSchemeHost 记录转发头中的协议和主机名，忽略非法值
+func setSchemeHost(info *reqinfo.Info, proto, host string) {
+	switch proto = strings.ToLower(proto); proto {
+	case "http", "https":
+		info.Scheme = proto
+	}
+	if netutil.ValidHost(host) {
+		info.Host = host
+	}
+}
+
+// singleValue 返回只有一个值的请求头，有多行或逗号分隔的多个值时返回空
+func singleValue(h http.Header, name string) string {
+	values := h.Values(name)
+	if len(values) != 1 || strings.Contains(values[0], ",") {
+		return ""
+	}
+	return strings.TrimSpace(values[0])
+}
+
+// fallbackHost 返回 Host 头不合法时使用的主机名：defaultHost 的值，为空时为网关监听的本地地址
+func fallbackHost(r *http.Request, defaultHost func() string) string {
+	if defaultHost != nil {
+		if host := defaultHost(); host != "" {
+			return host
+		}
+	}
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		return addr.String()
+	}
+	return "localhost"
+}
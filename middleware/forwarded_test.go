@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"cas-gateway/netutil"
+	"cas-gateway/reqinfo"
+)
+
+func TestForwarded(t *testing.T) {
+	trusted, err := netutil.ParseIPSet([]string{"10.0.0.0/8", "fd00::/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name        string
+		remote      string
+		host        string // 请求的 Host 头，为空时为 example.com
+		header      http.Header
+		defaultHost string
+		wantIP      string
+		wantScheme  string
+		wantHost    string
+	}{
+		// 不可信的对端
+		{"不可信对端忽略Forwarded", "198.51.100.1:1234", "", http.Header{"Forwarded": {"for=203.0.113.5;proto=https;host=app.example.com"}},
+			"", "198.51.100.1", "http", "example.com"},
+		{"不可信对端忽略X-Forwarded", "198.51.100.1:1234", "", http.Header{"X-Forwarded-For": {"203.0.113.5"}, "X-Forwarded-Proto": {"https"}, "X-Forwarded-Host": {"app.example.com"}},
+			"", "198.51.100.1", "http", "example.com"},
+
+		// RFC 7239 Forwarded
+		{"Forwarded单个节点", "10.0.0.1:1234", "", http.Header{"Forwarded": {"for=203.0.113.5;proto=https;host=app.example.com"}},
+			"", "203.0.113.5", "https", "app.example.com"},
+		{"Forwarded从右向左跳过可信代理", "10.0.0.1:1234", "", http.Header{"Forwarded": {"for=198.51.100.7;proto=http;host=evil.example.com, for=203.0.113.5;proto=https;host=app.example.com, for=10.0.0.2"}},
+			"", "203.0.113.5", "https", "app.example.com"},
+		{"Forwarded多行按顺序拼接", "10.0.0.1:1234", "", http.Header{"Forwarded": {"for=203.0.113.5;proto=https", "for=10.0.0.2"}},
+			"", "203.0.113.5", "https", "example.com"},
+		{"Forwarded全部可信时取最左节点", "10.0.0.1:1234", "", http.Header{"Forwarded": {"for=10.0.0.3;proto=https, for=10.0.0.2"}},
+			"", "10.0.0.3", "https", "example.com"},
+		{"Forwarded IPv6节点", "10.0.0.1:1234", "", http.Header{"Forwarded": {`for="[2001:db8::1]:4711";proto=https`}},
+			"", "2001:db8::1", "https", "example.com"},
+		{"Forwarded IPv6可信代理", "[fd00::1]:1234", "", http.Header{"Forwarded": {`for=203.0.113.5, for="[fd00::2]"`}},
+			"", "203.0.113.5", "http", "example.com"},
+		{"Forwarded隐藏标识的节点", "10.0.0.1:1234", "", http.Header{"Forwarded": {"for=unknown;proto=https"}},
+			"", "10.0.0.1", "https", "example.com"},
+		{"Forwarded非法协议和主机名", "10.0.0.1:1234", "", http.Header{"Forwarded": {`for=203.0.113.5;proto=ftp;host="a b"`}},
+			"", "203.0.113.5", "http", "example.com"},
+		{"Forwarded优先于X-Forwarded", "10.0.0.1:1234", "", http.Header{"Forwarded": {"for=203.0.113.5"}, "X-Forwarded-For": {"198.51.100.7"}, "X-Forwarded-Proto": {"https"}},
+			"", "203.0.113.5", "http", "example.com"},
+
+		// X-Forwarded-*
+		{"X-Forwarded-For从右向左", "10.0.0.1:1234", "", http.Header{"X-Forwarded-For": {"198.51.100.7, 203.0.113.5, 10.0.0.2"}},
+			"", "203.0.113.5", "http", "example.com"},
+		{"X-Forwarded-For多行", "10.0.0.1:1234", "", http.Header{"X-Forwarded-For": {"203.0.113.5", "10.0.0.2"}},
+			"", "203.0.113.5", "http", "example.com"},
+		{"X-Forwarded-For无法解析的地址", "10.0.0.1:1234", "", http.Header{"X-Forwarded-For": {"203.0.113.5, garbage, 10.0.0.2"}},
+			"", "10.0.0.2", "http", "example.com"},
+		{"X-Forwarded-For全部可信", "10.0.0.1:1234", "", http.Header{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}},
+			"", "10.0.0.3", "http", "example.com"},
+		{"单值协议和主机名", "10.0.0.1:1234", "", http.Header{"X-Forwarded-For": {"203.0.113.5"}, "X-Forwarded-Proto": {"HTTPS"}, "X-Forwarded-Host": {"app.example.com"}},
+			"", "203.0.113.5", "https", "app.example.com"},
+		{"多值协议忽略", "10.0.0.1:1234", "", http.Header{"X-Forwarded-Proto": {"https, http"}},
+			"", "10.0.0.1", "http", "example.com"},
+		{"多行主机名忽略", "10.0.0.1:1234", "", http.Header{"X-Forwarded-Host": {"evil.example.com", "app.example.com"}},
+			"", "10.0.0.1", "http", "example.com"},
+		{"非法主机名忽略", "10.0.0.1:1234", "", http.Header{"X-Forwarded-Host": {"app.example.com/path"}},
+			"", "10.0.0.1", "http", "example.com"},
+
+		// Host 头不合法
+		{"非法Host使用默认主机名", "198.51.100.1:1234", "bad host", nil,
+			"public.example.com", "198.51.100.1", "http", "public.example.com"},
+		{"非法Host使用本地地址", "198.51.100.1:1234", "a/b", nil,
+			"", "198.51.100.1", "http", "127.0.0.1:8080"},
+		{"非法Host由可信代理的主机名覆盖", "10.0.0.1:1234", "bad host", http.Header{"X-Forwarded-Host": {"app.example.com"}},
+			"public.example.com", "10.0.0.1", "http", "app.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remote
+			if tt.host != "" {
+				r.Host = tt.host
+			}
+			for k, v := range tt.header {
+				r.Header[k] = v
+			}
+			ctx := context.WithValue(r.Context(), http.LocalAddrContextKey, &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8080})
+			ctx, info := reqinfo.NewContext(ctx)
+
+			var defaultHost func() string
+			if tt.defaultHost != "" {
+				defaultHost = func() string { return tt.defaultHost }
+			}
+			var forwarded http.Header
+			Forwarded(trusted, defaultHost, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				forwarded = r.Header
+			})).ServeHTTP(httptest.NewRecorder(), r.WithContext(ctx))
+
+			if info.ClientIP != tt.wantIP || info.Scheme != tt.wantScheme || info.Host != tt.wantHost {
+				t.Fatalf("client=%q scheme=%q host=%q，期望 %q %q %q", info.ClientIP, info.Scheme, info.Host, tt.wantIP, tt.wantScheme, tt.wantHost)
+			}
+			// 不可信对端的转发头被删除，不会传给后端
+			if !trusted.Contains(netutil.RemoteIP(tt.remote)) {
+				for _, h := range forwardedHeaders {
+					if v := forwarded.Get(h); v != "" {
+						t.Errorf("不可信对端的 %s 未删除: %q", h, v)
+					}
+				}
+			}
+		})
+	}
+}
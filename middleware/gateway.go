@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"cas-gateway/auth"
+	"cas-gateway/metrics"
+	"cas-gateway/models"
+	"cas-gateway/reqinfo"
+
+	"github.com/gorilla/sessions"
+)
+
+// GatewayTriedCookie 记录已尝试过CAS网关模式的Cookie，避免反复跳转
+const GatewayTriedCookie = "cas_gateway_tried"
+
+// isOptionalAuth 判断请求路径是否为可选认证
+func isOptionalAuth(route *models.RouteConfig, path string) bool {
+	if route.Auth == models.AuthModeOptional {
+		return true
+	}
+	for _, p := range route.OptionalPaths {
+		if hasPathPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleOptional 处理可选认证请求（参考CAS协议 gateway=true）
+// 首次访问跳转CAS网关模式；CAS回跳带ticket则建立会话，不带ticket则匿名转发
+func (am *AuthMiddleware) handleOptional(w http.ResponseWriter, r *http.Request, next http.Handler, session *sessions.Session, route *models.RouteConfig) {
+	servicePath := stripTicket(r)
+	serviceURL := am.serviceURL(r, servicePath)
+
+	if am.authProvider.IsLoginPath(r.URL.String()) {
+		userInfo, err := am.login(w, r, session, serviceURL, auth.LoginOptions{})
+		if err == nil {
+			slog.InfoContext(r.Context(), "网关模式认证成功", "route", route.Name, "user", userInfo.Oaid, "redirect", servicePath)
+			http.Redirect(w, r, servicePath, http.StatusFound)
+			return
+		}
+		if am.sessionFailed(w, r, err) {
+			return
+		}
+		slog.WarnContext(r.Context(), "网关模式ticket验证失败，匿名访问", "route", route.Name, "path", r.URL.Path, "error", err)
+		am.serveAnonymous(w, r, next, route)
+		return
+	}
+
+	// 已经尝试过网关模式（CAS回跳未带ticket），说明没有SSO会话，匿名访问
+	if _, err := r.Cookie(GatewayTriedCookie); err == nil {
+		am.serveAnonymous(w, r, next, route)
+		return
+	}
+
+	// CAS不可用（熔断）或长连接请求（无法跟随跳转）时直接匿名访问
+	if ok, _ := am.authProvider.Available(); !ok || isStream(r) {
+		am.serveAnonymous(w, r, next, route)
+		return
+	}
+
+	// 浏览器会话级Cookie，关闭浏览器后重新探测；TLS 在前置代理终止时按转发头解析出的协议判断
+	secure := r.TLS != nil
+	if info := reqinfo.FromContext(r.Context()); info != nil && info.Scheme != "" {
+		secure = info.Scheme == "https"
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     GatewayTriedCookie,
+		Value:    "1",
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	loginURL := am.authProvider.GetLoginURL(serviceURL, auth.LoginOptions{Gateway: true})
+	slog.DebugContext(r.Context(), "可选认证，网关模式探测SSO会话", "route", route.Name, "path", r.URL.Path, "login_url", loginURL)
+	metrics.LoginRedirects.Inc("gateway")
+	http.Redirect(w, r, loginURL, http.StatusFound)
+}
+
+// serveAnonymous 匿名转发请求，清除客户端伪造的用户头
+func (am *AuthMiddleware) serveAnonymous(w http.ResponseWriter, r *http.Request, next http.Handler, route *models.RouteConfig) {
+	r.Header.Del("X-User")
+	r.Header.Del("X-Employee-Name")
+	slog.DebugContext(r.Context(), "匿名访问", "route", route.Name, "method", r.Method, "path", r.URL.Path)
+	if isStream(r) {
+		var done func()
+		w, r, done = am.streams.trackStream(w, r, "", streamIdleTimeout(route))
+		defer done()
+	}
+	stripRoutePrefix(r, route)
+	next.ServeHTTP(w, r)
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"cas-gateway/models"
+	"cas-gateway/netutil"
+	"cas-gateway/proxy"
+)
+
+func TestGatewayTriedCookieSecureBehindProxy(t *testing.T) {
+	route := &models.RouteConfig{Name: "app", Path: "/app", Target: "http://127.0.0.1:1", Auth: models.AuthModeOptional}
+	pm, err := proxy.NewProxyManager(route, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &models.ServerConfig{SessionKey: strings.Repeat("k", 32)}
+	am := NewAuthMiddleware(server, pm, fakeProvider{}, nil, NewStreamRegistry(), nil)
+	trusted, _ := netutil.ParseIPSet([]string{"192.0.2.1"})
+	h := RequestID(trusted, Forwarded(trusted, nil, am.Handler(pm.GetProxy())))
+
+	tests := []struct {
+		name   string
+		remote string
+		proto  string
+		secure bool
+	}{
+		{"可信代理终止TLS", "192.0.2.1:1234", "https", true},
+		{"可信代理HTTP", "192.0.2.1:1234", "http", false},
+		{"不可信客户端伪造协议", "198.51.100.1:1234", "https", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/app/", nil)
+		r.RemoteAddr = tt.remote
+		r.Header.Set("X-Forwarded-Proto", tt.proto)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		var cookie *http.Cookie
+		for _, c := range w.Result().Cookies() {
+			if c.Name == GatewayTriedCookie {
+				cookie = c
+			}
+		}
+		if cookie == nil {
+			t.Fatalf("%s: 未设置 %s Cookie（状态码 %d）", tt.name, GatewayTriedCookie, w.Code)
+		}
+		if cookie.Secure != tt.secure {
+			t.Errorf("%s: Secure = %v，期望 %v", tt.name, cookie.Secure, tt.secure)
+		}
+	}
+}
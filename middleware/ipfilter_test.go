@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"cas-gateway/models"
+)
+
+func TestIPFilter(t *testing.T) {
+	vpnOnly := []models.IPRuleConfig{{Allow: []string{"10.0.0.0/8", "2001:db8::/32"}}}
+	tests := []struct {
+		name   string
+		rules  []models.IPRuleConfig
+		remote string
+		path   string
+		want   int
+	}{
+		{"CIDR内", vpnOnly, "10.1.2.3", "/app/", http.StatusOK},
+		{"CIDR外", vpnOnly, "192.0.2.1", "/app/", http.StatusForbidden},
+		{"CIDR边界", []models.IPRuleConfig{{Allow: []string{"192.0.2.0/25"}}}, "192.0.2.128", "/app/", http.StatusForbidden},
+		{"单个IP", []models.IPRuleConfig{{Allow: []string{"192.0.2.7"}}}, "192.0.2.7", "/app/", http.StatusOK},
+		{"IPv6 CIDR内", vpnOnly, "2001:db8:1::5", "/app/", http.StatusOK},
+		{"IPv6 CIDR外", vpnOnly, "2001:db9::1", "/app/", http.StatusForbidden},
+		{"IPv4映射的IPv6地址", vpnOnly, "::ffff:10.0.0.1", "/app/", http.StatusOK},
+		{"单个IPv6地址", []models.IPRuleConfig{{Deny: []string{"2001:db8::1"}}}, "2001:db8::1", "/app/", http.StatusForbidden},
+		{"deny优先于allow", []models.IPRuleConfig{{Allow: []string{"10.0.0.0/8"}, Deny: []string{"10.9.0.0/16"}}}, "10.9.1.1", "/app/", http.StatusForbidden},
+		{"deny之外按allow放行", []models.IPRuleConfig{{Allow: []string{"10.0.0.0/8"}, Deny: []string{"10.9.0.0/16"}}}, "10.8.1.1", "/app/", http.StatusOK},
+		{"只有deny时其他地址放行", []models.IPRuleConfig{{Deny: []string{"192.0.2.0/24"}}}, "198.51.100.1", "/app/", http.StatusOK},
+		{"只有deny时命中拒绝", []models.IPRuleConfig{{Deny: []string{"192.0.2.0/24"}}}, "192.0.2.1", "/app/", http.StatusForbidden},
+		{"路径规则不匹配", []models.IPRuleConfig{{Path: "/app/admin", Allow: []string{"10.0.0.0/8"}}}, "192.0.2.1", "/app/administrator", http.StatusOK},
+		{"路径规则匹配", []models.IPRuleConfig{{Path: "/app/admin", Allow: []string{"10.0.0.0/8"}}}, "192.0.2.1", "/app/admin/users", http.StatusForbidden},
+		{"多条规则都需要通过", []models.IPRuleConfig{{Allow: []string{"10.0.0.0/8", "192.0.2.0/24"}}, {Path: "/app/admin", Allow: []string{"10.0.0.0/8"}}}, "192.0.2.1", "/app/admin", http.StatusForbidden},
+		{"健康检查不受限制", vpnOnly, "192.0.2.1", "/health", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := &models.RouteConfig{Name: "app", Path: "/app", IPRules: tt.rules}
+			f, err := NewIPFilter(route, nil, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			h := f.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			r.RemoteAddr = net.JoinHostPort(tt.remote, "1234")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("%s 访问 %s 状态码 = %d，期望 %d", tt.remote, tt.path, w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestIPFilterDeniedMessage(t *testing.T) {
+	route := &models.RouteConfig{Name: "app", IPRules: []models.IPRuleConfig{{Allow: []string{"10.0.0.0/8"}}}}
+	f, err := NewIPFilter(route, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Language", "en")
+	w := httptest.NewRecorder()
+	f.Handler(http.NotFoundHandler()).ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "Access from your network is not allowed") {
+		t.Fatalf("状态码 = %d，页面应提示网络不允许访问: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestIPFilterInvalidRule(t *testing.T) {
+	for _, cidr := range []string{"10.0.0.0/33", "not-an-ip", "2001:db8::/129"} {
+		route := &models.RouteConfig{Name: "app", IPRules: []models.IPRuleConfig{{Deny: []string{cidr}}}}
+		if _, err := NewIPFilter(route, nil, nil, nil); err == nil {
+			t.Errorf("规则 %q 应返回错误", cidr)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"cas-gateway/pages"
+)
+
+// HandleLogout 处理 /logout：清除会话后跳转到CAS登出，登出后回到 service 参数或 Referer 指定的地址；CAS不可用时显示已登出页面
+// 跳转地址必须是网关自身地址或 route.logout.allowed_redirects 中的地址，否则回到路由首页，避免开放重定向；
+// 开启 route.logout.confirm 时 GET 请求只显示确认页面，POST 才登出；其他方法（包括 HEAD）返回405，避免链接预取等请求触发登出
+func (am *AuthMiddleware) HandleLogout(w http.ResponseWriter, r *http.Request) {
+	route := am.proxyManager.GetRoute()
+	routePath := route.Path
+	if routePath == "" {
+		routePath = "/"
+	}
+	home := am.serviceURL(r, routePath)
+
+	switch r.Method {
+	case http.MethodGet:
+		if route.Logout.Confirm {
+			am.pages.LogoutConfirm(w, r, r.URL.RequestURI())
+			return
+		}
+	case http.MethodPost:
+		if route.Logout.Confirm && !sameOrigin(r, home) {
+			slog.WarnContext(r.Context(), "拒绝跨站登出请求", "route", route.Name, "origin", r.Header.Get("Origin"))
+			am.pages.ErrorMessage(w, r, http.StatusForbidden, pages.MessageLogoutCrossSite)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		am.pages.Error(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	service := home
+	for _, candidate := range []string{r.URL.Query().Get("service"), r.Referer()} {
+		if candidate == "" {
+			continue
+		}
+		if allowedRedirect(candidate, home, route.Logout.AllowedRedirects) {
+			service = candidate
+			break
+		}
+		slog.WarnContext(r.Context(), "登出跳转地址不在允许列表中，忽略", "route", route.Name, "service", candidate)
+	}
+
+	am.Logout(w, r)
+	// CAS熔断期间跳转CAS登出只会得到错误页，本地会话已清除，直接显示已登出页面
+	if ok, _ := am.authProvider.Available(); !ok {
+		slog.WarnContext(r.Context(), "CAS不可用，登出后显示本地页面", "route", route.Name)
+		am.pages.Logout(w, r, home)
+		return
+	}
+	logoutURL := am.authProvider.GetLogoutURL(service)
+	slog.InfoContext(r.Context(), "登出，重定向到CAS", "route", route.Name, "logout_url", logoutURL)
+	http.Redirect(w, r, logoutURL, http.StatusFound)
+}
+
+// allowedRedirect 判断登出后跳转地址是否允许：与网关地址同源，或与允许列表中某项协议、主机相同且路径按段前缀匹配
+func allowedRedirect(target, home string, allowed []string) bool {
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+		return false
+	}
+	if h, err := url.Parse(home); err == nil && sameHost(u, h) {
+		return true
+	}
+	for _, a := range allowed {
+		au, err := url.Parse(a)
+		if err == nil && sameHost(u, au) && hasPathPrefix(u.Path, au.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameHost 判断两个地址的协议和主机（含端口）是否相同
+func sameHost(a, b *url.URL) bool {
+	return a.Scheme == b.Scheme && strings.EqualFold(a.Host, b.Host)
+}
+
+// sameOrigin 判断 POST 请求是否来自网关自身页面；不发送 Origin 的旧浏览器按 Sec-Fetch-Site 判断，都没有时放行
+func sameOrigin(r *http.Request, home string) bool {
+	if r.Header.Get("Sec-Fetch-Site") == "cross-site" {
+		return false
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	o, err := url.Parse(origin)
+	h, herr := url.Parse(home)
+	return err == nil && herr == nil && sameHost(o, h)
+}
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAllowedRedirect(t *testing.T) {
+	const home = "https://gw.example.com/app"
+	allowed := []string{"https://portal.example.com/home", "http://legacy.example.com"}
+	tests := []struct {
+		target string
+		want   bool
+	}{
+		{"https://gw.example.com/app/page?x=1", true},
+		{"https://GW.example.com/other", true}, // 与网关同源，不限路径，主机名不区分大小写
+		{"http://gw.example.com/app", false},   // 协议不同
+		{"https://gw.example.com:8443/app", false},
+		{"https://portal.example.com/home", true},
+		{"https://portal.example.com/home/news", true},
+		{"https://portal.example.com/homepage", false}, // 路径按段匹配
+		{"https://portal.example.com/", false},
+		{"http://portal.example.com/home", false},
+		{"http://legacy.example.com/any/path", true}, // 允许项没有路径时匹配整个主机
+		{"https://evil.example.com/home", false},
+		{"https://gw.example.com.evil.com/app", false},
+		{"https://user@gw.example.com/app", false}, // 带用户信息
+		{"//evil.example.com/app", false},          // 协议相对地址
+		{"/app/page", false},                       // 相对地址
+		{"javascript:alert(1)", false},
+		{"https://gw.example.com/%zz", false}, // 无法解析
+	}
+	for _, tt := range tests {
+		if got := allowedRedirect(tt.target, home, allowed); got != tt.want {
+			t.Errorf("allowedRedirect(%q) = %v，期望 %v", tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestSameOrigin(t *testing.T) {
+	const home = "https://gw.example.com/app"
+	tests := []struct {
+		name      string
+		origin    string
+		fetchSite string
+		want      bool
+	}{
+		{"同源", "https://gw.example.com", "same-origin", true},
+		{"主机名大小写", "https://GW.EXAMPLE.COM", "", true},
+		{"跨站 Origin", "https://evil.example.com", "", false},
+		{"协议不同", "http://gw.example.com", "", false},
+		{"端口不同", "https://gw.example.com:8443", "", false},
+		{"Origin 为 null", "null", "", false},
+		{"只有 Sec-Fetch-Site 跨站", "", "cross-site", false},
+		{"Sec-Fetch-Site 同站", "", "same-site", true},
+		{"都没有时放行", "", "", true},
+		{"Sec-Fetch-Site 跨站优先", "https://gw.example.com", "cross-site", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/logout", nil)
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		if tt.fetchSite != "" {
+			r.Header.Set("Sec-Fetch-Site", tt.fetchSite)
+		}
+		if got := sameOrigin(r, home); got != tt.want {
+			t.Errorf("%s: sameOrigin = %v，期望 %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLogoutMethods(t *testing.T) {
+	gw := newStreamGateway(t, newStreamBackend(t, nil).URL, 0)
+	for _, method := range []string{http.MethodHead, http.MethodPut, http.MethodDelete} {
+		cookie := loginCookie(t, gw.URL)
+		req, _ := http.NewRequest(method, gw.URL+"/logout", nil)
+		req.Header.Set("Cookie", cookie)
+		resp, err := noRedirect.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusMethodNotAllowed || resp.Header.Get("Allow") != "GET, POST" {
+			t.Fatalf("%s /logout 状态码 = %d，Allow = %q，期望 405", method, resp.StatusCode, resp.Header.Get("Allow"))
+		}
+		// 会话仍然有效
+		if resp, _ := getWithCookie(t, gw.URL+"/logout", cookie); resp.StatusCode != http.StatusFound {
+			t.Fatalf("%s 请求后登出状态码 = %d", method, resp.StatusCode)
+		}
+	}
+}
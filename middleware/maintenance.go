@@ -0,0 +1,152 @@
+package middleware
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+	"cas-gateway/models"
+	"cas-gateway/netutil"
+	"cas-gateway/pages"
+)
+
+// 维护模式开启来源
+const (
+	MaintenanceSourceAdmin  = "admin"
+	MaintenanceSourceFlag   = "flag_file"
+	MaintenanceSourceConfig = "config"
+)
+
+// flagFileCheckInterval 标记文件检查结果的缓存时间，避免每个请求都访问文件系统
+const flagFileCheckInterval = time.Second
+
+// defaultMaintenanceRetryAfter 维护页面默认的 Retry-After
+const defaultMaintenanceRetryAfter = 5 * time.Minute
+
+// MaintenanceState 维护模式的运行时状态：管理端点设置的开关（配置重载后保留）和标记文件检查缓存
+type MaintenanceState struct {
+	mu        sync.Mutex
+	overrides map[string]bool // 路由名称 -> 管理端点设置的开关
+	flags     map[string]flagCheck
+}
+
+type flagCheck struct {
+	exists  bool
+	checked time.Time
+}
+
+// NewMaintenanceState 创建维护模式状态
+func NewMaintenanceState() *MaintenanceState {
+	return &MaintenanceState{
+		overrides: make(map[string]bool),
+		flags:     make(map[string]flagCheck),
+	}
+}
+
+// Set 通过管理端点开启或关闭路由的维护模式，优先于配置和标记文件
+func (s *MaintenanceState) Set(route string, enabled bool) {
+	s.mu.Lock()
+	s.overrides[route] = enabled
+	s.mu.Unlock()
+}
+
+// Clear 清除管理端点的设置，恢复由配置和标记文件决定
+func (s *MaintenanceState) Clear(route string) {
+	s.mu.Lock()
+	delete(s.overrides, route)
+	s.mu.Unlock()
+}
+
+// Enabled 返回路由当前是否处于维护模式及开启来源
+func (s *MaintenanceState) Enabled(route *models.RouteConfig) (bool, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if enabled, ok := s.overrides[route.Name]; ok {
+		return enabled, MaintenanceSourceAdmin
+	}
+	if path := route.Maintenance.FlagFile; path != "" {
+		check, ok := s.flags[path]
+		if !ok || time.Since(check.checked) > flagFileCheckInterval {
+			_, err := os.Stat(path)
+			check = flagCheck{exists: err == nil, checked: time.Now()}
+			s.flags[path] = check
+		}
+		if check.exists {
+			return true, MaintenanceSourceFlag
+		}
+	}
+	if route.Maintenance.Enabled {
+		return true, MaintenanceSourceConfig
+	}
+	return false, ""
+}
+
+// Maintenance 路由维护模式检查，位于认证之前，未登录的用户直接看到维护页面，不会跳转CAS登录
+type Maintenance struct {
+	route      *models.RouteConfig
+	state      *MaintenanceState
+	allowUsers map[string]bool
+	allowIPs   netutil.IPSet
+	userOf     func(r *http.Request) string
+	pages      *pages.Set
+}
+
+// NewMaintenance 创建维护模式检查，userOf 用于从会话Cookie获取请求的用户（检查 allow_users）
+func NewMaintenance(route *models.RouteConfig, state *MaintenanceState, userOf func(r *http.Request) string, pageSet *pages.Set) (*Maintenance, error) {
+	allowIPs, err := netutil.ParseIPSet(route.Maintenance.AllowIPs)
+	if err != nil {
+		return nil, fmt.Errorf("maintenance.allow_ips 无效: %w", err)
+	}
+	allowUsers := make(map[string]bool, len(route.Maintenance.AllowUsers))
+	for _, u := range route.Maintenance.AllowUsers {
+		allowUsers[u] = true
+	}
+	return &Maintenance{
+		route:      route,
+		state:      state,
+		allowUsers: allowUsers,
+		pages:      pageSet,
+		allowIPs:   allowIPs,
+		userOf:     userOf,
+	}, nil
+}
+
+// Handler 维护期间白名单用户和IP正常转发，其他请求返回 503 维护页面；/health 不检查，维护不影响负载均衡器健康检查
+func (m *Maintenance) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		enabled, source := m.state.Enabled(m.route)
+		if !enabled || m.allowed(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		retryAfter := m.route.Maintenance.RetryAfter
+		if retryAfter <= 0 {
+			retryAfter = defaultMaintenanceRetryAfter
+		}
+		slog.DebugContext(r.Context(), "维护模式，拒绝访问", "route", m.route.Name, "path", r.URL.Path, "source", source)
+		m.pages.Maintenance(w, r, retryAfter, m.route.Maintenance.Message)
+	})
+}
+
+// allowed 判断请求是否在维护白名单中
+func (m *Maintenance) allowed(r *http.Request) bool {
+	if len(m.allowIPs) > 0 && m.allowIPs.Contains(net.ParseIP(clientIP(r))) {
+		return true
+	}
+	if len(m.allowUsers) == 0 {
+		return false
+	}
+	user := ""
+	if m.userOf != nil {
+		user = m.userOf(r)
+	}
+	return user != "" && m.allowUsers[user]
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"cas-gateway/models"
+	"cas-gateway/proxy"
+)
+
+// newMaintenanceGateway 按 newGateway 的顺序组装：维护模式检查在认证之前
+func newMaintenanceGateway(t *testing.T, cfg models.MaintenanceConfig) *httptest.Server {
+	t.Helper()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(backend.Close)
+	route := &models.RouteConfig{Name: "app", Path: "/app", Target: backend.URL, Maintenance: cfg}
+	pm, err := proxy.NewProxyManager(route, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &models.ServerConfig{SessionKey: strings.Repeat("k", 32)}
+	am := NewAuthMiddleware(server, pm, fakeProvider{}, nil, NewStreamRegistry(), nil)
+	maint, err := NewMaintenance(route, NewMaintenanceState(), am.GetUser, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {})
+	mux.Handle("/", pm.GetProxy())
+	gw := httptest.NewServer(maint.Handler(am.Handler(mux)))
+	t.Cleanup(gw.Close)
+	return gw
+}
+
+func TestMaintenanceBeforeAuth(t *testing.T) {
+	gw := newMaintenanceGateway(t, models.MaintenanceConfig{Enabled: true, AllowUsers: []string{"alice"}})
+
+	// 未登录的用户看到维护页面，而不是跳转CAS登录
+	resp, _ := getWithCookie(t, gw.URL+"/app/", "")
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") == "" {
+		t.Fatalf("未登录请求状态码 = %d，Location = %q，期望 503 维护页面", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	if resp, _ := getWithCookie(t, gw.URL+"/health", ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("/health 状态码 = %d，期望 200", resp.StatusCode)
+	}
+}
+
+func TestMaintenanceAllowUsersBySession(t *testing.T) {
+	// 先在维护关闭时登录，再开启维护
+	gw := newMaintenanceGateway(t, models.MaintenanceConfig{AllowUsers: []string{"alice"}})
+	cookie := loginCookie(t, gw.URL)
+
+	gw = newMaintenanceGateway(t, models.MaintenanceConfig{Enabled: true, AllowUsers: []string{"alice"}})
+	if resp, _ := getWithCookie(t, gw.URL+"/app/", cookie); resp.StatusCode != http.StatusOK {
+		t.Fatalf("白名单用户状态码 = %d，期望 200", resp.StatusCode)
+	}
+
+	gw = newMaintenanceGateway(t, models.MaintenanceConfig{Enabled: true, AllowUsers: []string{"bob"}})
+	if resp, _ := getWithCookie(t, gw.URL+"/app/", cookie); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("非白名单用户状态码 = %d，期望 503", resp.StatusCode)
+	}
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+	"cas-gateway/metrics"
+	"cas-gateway/reqinfo"
+)
+
+// MetricsHandler 记录请求计数和延迟指标，路由名称取自认证中间件记录的请求信息，网关内置端点记为 internal
+func MetricsHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := newResponseRecorder(w)
+		next.ServeHTTP(rec, r)
+
+		route := "internal"
+		if info := reqinfo.FromContext(r.Context()); info != nil && info.Route != "" {
+			route = info.Route
+		}
+		status := strconv.Itoa(rec.Status())
+		method := metricMethod(r.Method)
+		metrics.HTTPRequests.Inc(route, method, status)
+		metrics.HTTPRequestDuration.Observe(time.Since(start).Seconds(), route, method, status)
+	})
+}
+
+// metricMethod 归一化请求方法，避免任意方法名导致标签基数膨胀
+func metricMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions, http.MethodConnect, http.MethodTrace:
+		return method
+	}
+	return "OTHER"
+}
@@ -0,0 +1,235 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+	"cas-gateway/metrics"
+	"cas-gateway/models"
+	"cas-gateway/pages"
+	"cas-gateway/reqinfo"
+)
+
+// bucketSweepInterval 清理空闲令牌桶的间隔，桶已补满即视为空闲
+const bucketSweepInterval = time.Minute
+
+// maxBuckets 每条规则最多保存的令牌桶数量；达到上限后新的用户或 token 改按客户端IP计数，
+// 避免客户端每次换一个 token 得到新的令牌桶，同时限制内存占用
+const maxBuckets = 10000
+
+// RateLimiter 路由限流，令牌桶保存在内存中（单实例有效，配置重载后重新计数）
+type RateLimiter struct {
+	route  *models.RouteConfig
+	rules  []*limitRule
+	userOf func(r *http.Request) string
+	pages  *pages.Set
+}
+
+// limitRule 一条限流规则及其令牌桶
+type limitRule struct {
+	cfg   models.RateLimitConfig
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// limitResult 一次检查的结果，用于输出 RateLimit-* 响应头
+type limitResult struct {
+	allowed    bool
+	limit      int
+	remaining  int
+	reset      time.Duration // 令牌补满（被拒绝时为下一个令牌可用）所需时间
+	retryAfter time.Duration
+}
+
+// NewRateLimiter 创建路由限流，userOf 用于获取未经过认证的请求（如静态文件）的会话用户
+func NewRateLimiter(route *models.RouteConfig, userOf func(r *http.Request) string, pageSet *pages.Set) *RateLimiter {
+	rl := &RateLimiter{route: route, userOf: userOf, pages: pageSet}
+	for _, cfg := range route.RateLimits {
+		burst := float64(cfg.Burst)
+		if burst <= 0 {
+			burst = math.Ceil(cfg.Rate)
+		}
+		rl.rules = append(rl.rules, &limitRule{cfg: cfg, burst: burst, buckets: make(map[string]*bucket)})
+	}
+	return rl
+}
+
+// Handler 检查所有匹配的规则，任一规则超限时返回 429；响应头给出剩余额度最少的规则
+func (rl *RateLimiter) Handler(next http.Handler) http.Handler {
+	if len(rl.rules) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var tightest *limitResult
+		now := time.Now()
+		path := originalPath(r)
+		ipKey := "ip:" + clientIP(r)
+		type taken struct {
+			rule *limitRule
+			key  string
+		}
+		var passed []taken
+		for _, rule := range rl.rules {
+			if !hasPathPrefix(path, rule.cfg.Path) {
+				continue
+			}
+			key, res := rule.take(rl.key(r, &rule.cfg), ipKey, now)
+			if !res.allowed {
+				// 被拒绝的请求不消耗之前规则的额度
+				for _, t := range passed {
+					t.rule.refund(t.key)
+				}
+				metrics.RateLimitRequests.Inc(rl.route.Name, ruleLabel(&rule.cfg), "limited")
+				setRateLimitHeaders(w, res)
+				seconds := int(math.Ceil(res.retryAfter.Seconds()))
+				w.Header().Set("Retry-After", strconv.Itoa(seconds))
+				slog.DebugContext(r.Context(), "请求超过限流", "route", rl.route.Name, "path", path, "rule", ruleLabel(&rule.cfg), "key", rule.cfg.Key, "retry_after", seconds)
+				rl.pages.Error(w, r, http.StatusTooManyRequests)
+				return
+			}
+			passed = append(passed, taken{rule, key})
+			if tightest == nil || res.remaining < tightest.remaining {
+				tightest = &res
+			}
+		}
+		for _, t := range passed {
+			metrics.RateLimitRequests.Inc(rl.route.Name, ruleLabel(&t.rule.cfg), "allowed")
+		}
+		if tightest != nil {
+			setRateLimitHeaders(w, *tightest)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// originalPath 返回剥离路由前缀之前的请求路径，与 renew、optional_paths 的匹配方式一致
+func originalPath(r *http.Request) string {
+	if u, err := url.ParseRequestURI(r.RequestURI); err == nil {
+		return u.Path
+	}
+	return r.URL.Path
+}
+
+// key 返回请求在规则下的限流键，取不到用户或 token 时按客户端IP；
+// token 未经网关验证，按客户端IP和 token 组合计数
+func (rl *RateLimiter) key(r *http.Request, cfg *models.RateLimitConfig) string {
+	switch cfg.Key {
+	case models.RateLimitKeyIP:
+	case models.RateLimitKeyToken:
+		header := cfg.Header
+		if header == "" {
+			header = "Authorization"
+		}
+		if token := r.Header.Get(header); token != "" {
+			// 只保存摘要，避免在内存中长期持有 token 明文
+			sum := sha256.Sum256([]byte(token))
+			return "token:" + clientIP(r) + ":" + hex.EncodeToString(sum[:16])
+		}
+	default:
+		user := ""
+		if info := reqinfo.FromContext(r.Context()); info != nil {
+			user = info.User
+		}
+		if user == "" && rl.userOf != nil {
+			user = rl.userOf(r)
+		}
+		if user != "" {
+			return "user:" + user
+		}
+	}
+	return "ip:" + clientIP(r)
+}
+
+// take 从令牌桶中取一个令牌，返回实际使用的限流键；令牌桶数量达到上限时新的键改用 ipKey
+func (lr *limitRule) take(key, ipKey string, now time.Time) (string, limitResult) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	lr.sweep(now)
+
+	rate := lr.cfg.Rate
+	b, ok := lr.buckets[key]
+	if !ok && key != ipKey && len(lr.buckets) >= maxBuckets {
+		key = ipKey
+		b, ok = lr.buckets[key]
+	}
+	if !ok {
+		b = &bucket{tokens: lr.burst, last: now}
+		lr.buckets[key] = b
+	}
+	b.tokens = math.Min(lr.burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	res := limitResult{limit: int(lr.burst)}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.allowed = true
+		res.remaining = int(b.tokens)
+		res.reset = seconds((lr.burst - b.tokens) / rate)
+		return key, res
+	}
+	res.retryAfter = seconds((1 - b.tokens) / rate)
+	res.reset = res.retryAfter
+	return key, res
+}
+
+// refund 退还 take 取走的令牌（请求被后面的规则拒绝时）
+func (lr *limitRule) refund(key string) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	if b, ok := lr.buckets[key]; ok {
+		b.tokens = math.Min(lr.burst, b.tokens+1)
+	}
+}
+
+// sweep 定期删除已补满的令牌桶，调用方需持有锁
+func (lr *limitRule) sweep(now time.Time) {
+	if now.Sub(lr.lastSweep) < bucketSweepInterval {
+		return
+	}
+	lr.lastSweep = now
+	for key, b := range lr.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*lr.cfg.Rate >= lr.burst {
+			delete(lr.buckets, key)
+		}
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// setRateLimitHeaders 输出 RateLimit-Limit/Remaining/Reset 响应头（IETF RateLimit header fields 草案）
+func setRateLimitHeaders(w http.ResponseWriter, res limitResult) {
+	h := w.Header()
+	h.Set("RateLimit-Limit", strconv.Itoa(res.limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(res.remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil(res.reset.Seconds()))))
+}
+
+// ruleLabel 返回规则在指标和日志中的标识
+func ruleLabel(cfg *models.RateLimitConfig) string {
+	path := cfg.Path
+	if path == "" {
+		path = "/"
+	}
+	key := cfg.Key
+	if key == "" {
+		key = models.RateLimitKeyUser
+	}
+	return fmt.Sprintf("%s:%s", key, path)
+}
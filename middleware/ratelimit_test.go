@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"cas-gateway/models"
+)
+
+func serveLimited(h http.Handler, target, token string) int {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	if token != "" {
+		r.Header.Set("Authorization", token)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w.Code
+}
+
+func TestRateLimitRefundOnLaterRule(t *testing.T) {
+	route := &models.RouteConfig{Name: "app", RateLimits: []models.RateLimitConfig{
+		{Key: models.RateLimitKeyIP, Rate: 0.001, Burst: 2},
+		{Path: "/app/api", Key: models.RateLimitKeyIP, Rate: 0.001, Burst: 1},
+	}}
+	h := NewRateLimiter(route, nil, nil).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	steps := []struct {
+		target string
+		want   int
+	}{
+		{"/app/api", http.StatusOK},
+		{"/app/api", http.StatusTooManyRequests}, // 第二条规则拒绝，第一条规则的令牌退还
+		{"/app/other", http.StatusOK},
+		{"/app/other", http.StatusTooManyRequests},
+	}
+	for i, s := range steps {
+		if got := serveLimited(h, s.target, ""); got != s.want {
+			t.Fatalf("第 %d 个请求 %s 状态码 = %d，期望 %d", i+1, s.target, got, s.want)
+		}
+	}
+}
+
+func TestRateLimitTokenScopedByIP(t *testing.T) {
+	route := &models.RouteConfig{Name: "app", RateLimits: []models.RateLimitConfig{
+		{Key: models.RateLimitKeyToken, Rate: 0.001, Burst: 1},
+	}}
+	rl := NewRateLimiter(route, nil, nil)
+	r1 := httptest.NewRequest(http.MethodGet, "/", nil)
+	r1.Header.Set("Authorization", "Bearer a")
+	r2 := httptest.NewRequest(http.MethodGet, "/", nil)
+	r2.Header.Set("Authorization", "Bearer a")
+	r2.RemoteAddr = "198.51.100.9:1234"
+	if k1, k2 := rl.key(r1, &route.RateLimits[0]), rl.key(r2, &route.RateLimits[0]); k1 == k2 {
+		t.Fatalf("不同客户端IP使用同一 token 应分别计数: %q", k1)
+	}
+}
+
+func TestRateLimitBucketCapFallsBackToIP(t *testing.T) {
+	rule := &limitRule{cfg: models.RateLimitConfig{Rate: 0.001}, burst: 1, buckets: make(map[string]*bucket)}
+	now := time.Now()
+	rule.lastSweep = now
+	for i := 0; i < maxBuckets; i++ {
+		rule.take(fmt.Sprintf("token:%d", i), "ip:192.0.2.1", now)
+	}
+
+	// 达到上限后，每次换新 token 都按客户端IP计数，不能绕过限流
+	key, res := rule.take("token:new-1", "ip:192.0.2.1", now)
+	if key != "ip:192.0.2.1" || !res.allowed {
+		t.Fatalf("达到上限后应按IP计数: key=%q allowed=%v", key, res.allowed)
+	}
+	if _, res := rule.take("token:new-2", "ip:192.0.2.1", now); res.allowed {
+		t.Fatal("换新 token 不应得到新的令牌桶")
+	}
+	if len(rule.buckets) != maxBuckets+1 {
+		t.Fatalf("令牌桶数量 = %d，期望 %d", len(rule.buckets), maxBuckets+1)
+	}
+	// 已有的 token 继续使用自己的令牌桶
+	if key, _ := rule.take("token:0", "ip:192.0.2.1", now); key != "token:0" {
+		t.Fatalf("已有 token 的限流键 = %q", key)
+	}
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+	"cas-gateway/models"
+
+	"github.com/gorilla/sessions"
+)
+
+// matchRenewRule 查找与请求路径匹配的强制重新认证规则
+func matchRenewRule(route *models.RouteConfig, path string) *models.RenewConfig {
+	for i := range route.Renew {
+		rule := &route.Renew[i]
+		if hasPathPrefix(path, rule.Path) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// renewRequired 判断session中的认证时间是否已超过规则允许的时长
+func renewRequired(rule *models.RenewConfig, authTime int64) bool {
+	if authTime <= 0 || rule.MaxAge <= 0 {
+		return true
+	}
+	return time.Since(time.Unix(authTime, 0)) > rule.MaxAge
+}
+
+// takeRenewed 判断会话是否刚通过该规则的重新认证，是则清除标记并放行本次请求
+func takeRenewed(w http.ResponseWriter, r *http.Request, session *sessions.Session, rule *models.RenewConfig) bool {
+	if path, ok := session.Values[RenewedKey].(string); !ok || path != rule.Path {
+		return false
+	}
+	delete(session.Values, RenewedKey)
+	if err := session.Save(r, w); err != nil {
+		slog.WarnContext(r.Context(), "清除重新认证标记失败", "error", err)
+	}
+	return true
+}
+
+// stripTicket 返回去除ticket参数后的请求路径（含查询参数），用于构建service URL和回跳地址
+func stripTicket(r *http.Request) string {
+	q := r.URL.Query()
+	q.Del("ticket")
+	path := r.URL.Path
+	if encoded := q.Encode(); encoded != "" {
+		path += "?" + encoded
+	}
+	return path
+}
+
+// sessionAuthTime 读取session中记录的认证时间（Unix秒）
+func sessionAuthTime(values map[interface{}]interface{}) int64 {
+	if t, ok := values[AuthTimeKey].(int64); ok {
+		return t
+	}
+	return 0
+}
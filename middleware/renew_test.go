@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"cas-gateway/models"
+	"cas-gateway/proxy"
+)
+
+// newRenewGateway 后端对所有请求返回200，/app/approve 每次访问都要求重新认证（max_age 为 0）
+func newRenewGateway(t *testing.T) *httptest.Server {
+	t.Helper()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(backend.Close)
+	route := &models.RouteConfig{
+		Name:   "app",
+		Path:   "/app",
+		Target: backend.URL,
+		Renew:  []models.RenewConfig{{Path: "/app/approve"}},
+	}
+	pm, err := proxy.NewProxyManager(route, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &models.ServerConfig{SessionKey: strings.Repeat("k", 32)}
+	am := NewAuthMiddleware(server, pm, fakeProvider{}, nil, NewStreamRegistry(), nil)
+	gw := httptest.NewServer(am.Handler(pm.GetProxy()))
+	t.Cleanup(gw.Close)
+	return gw
+}
+
+// getWithCookie 发送请求，响应设置了新的会话 Cookie 时返回新值
+func getWithCookie(t *testing.T, target, cookie string) (*http.Response, string) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, target, nil)
+	req.Header.Set("Cookie", cookie)
+	resp, err := noRedirect.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	for _, c := range resp.Cookies() {
+		if c.Name == SessionName {
+			cookie = c.Name + "=" + c.Value
+		}
+	}
+	return resp, cookie
+}
+
+func TestRenewMaxAgeZeroDoesNotLoop(t *testing.T) {
+	gw := newRenewGateway(t)
+	cookie := loginCookie(t, gw.URL)
+
+	resp, cookie := getWithCookie(t, gw.URL+"/app/approve", cookie)
+	if resp.StatusCode != http.StatusFound || !strings.HasPrefix(resp.Header.Get("Location"), "https://cas.test/login") {
+		t.Fatalf("访问敏感路径应跳转CAS，得到 %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	resp, cookie = getWithCookie(t, gw.URL+"/app/approve?ticket=ST-ok", cookie)
+	if resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != "/app/approve" {
+		t.Fatalf("重新认证后应回跳原页面，得到 %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	// 回跳后的请求放行一次
+	resp, cookie = getWithCookie(t, gw.URL+"/app/approve", cookie)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("重新认证后回跳的请求应放行，得到 %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	// 标记只生效一次，之后再次要求重新认证
+	resp, _ = getWithCookie(t, gw.URL+"/app/approve", cookie)
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("再次访问应重新认证，得到 %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"net/http"
+	"cas-gateway/netutil"
+	"cas-gateway/reqinfo"
+)
+
+// RequestID 创建请求上下文并分配请求ID，需放在最外层
+// 仅当请求来自可信代理且格式合法时沿用传入的 X-Request-ID，否则重新生成；请求ID会回写到响应头
+func RequestID(trustedProxies netutil.IPSet, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, info := reqinfo.NewContext(r.Context())
+
+		id := r.Header.Get(reqinfo.HeaderRequestID)
+		if !reqinfo.ValidRequestID(id) || !trustedProxies.Contains(netutil.RemoteIP(r.RemoteAddr)) {
+			id = reqinfo.NewRequestID()
+		}
+		info.RequestID = id
+		w.Header().Set(reqinfo.HeaderRequestID, id)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
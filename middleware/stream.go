@@ -0,0 +1,230 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"cas-gateway/models"
+)
+
+// defaultStreamIdleTimeout 长连接默认空闲超时
+const defaultStreamIdleTimeout = 10 * time.Minute
+
+// isUpgrade 判断是否为协议升级请求（WebSocket）
+func isUpgrade(r *http.Request) bool {
+	if r.Header.Get("Upgrade") == "" {
+		return false
+	}
+	for _, v := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isEventStream 判断是否为 Server-Sent Events 请求（EventSource 发送 Accept: text/event-stream）
+func isEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// isStream 判断是否为长连接请求；这类请求不能跟随跳转到CAS登录页，未认证时返回401
+func isStream(r *http.Request) bool {
+	return isUpgrade(r) || isEventStream(r)
+}
+
+// streamIdleTimeout 返回路由的长连接空闲超时，0 表示不限制
+func streamIdleTimeout(route *models.RouteConfig) time.Duration {
+	switch {
+	case route.StreamIdleTimeout < 0:
+		return 0
+	case route.StreamIdleTimeout == 0:
+		return defaultStreamIdleTimeout
+	}
+	return route.StreamIdleTimeout
+}
+
+// StreamRegistry 记录进行中的长连接（WebSocket、SSE），会话登出时关闭该会话的连接；配置重载后保留
+type StreamRegistry struct {
+	mu      sync.Mutex
+	streams map[string]map[*stream]struct{} // 会话标识 -> 连接
+}
+
+// NewStreamRegistry 创建长连接登记表
+func NewStreamRegistry() *StreamRegistry {
+	return &StreamRegistry{streams: make(map[string]map[*stream]struct{})}
+}
+
+func (sr *StreamRegistry) add(key string, s *stream) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	if sr.streams[key] == nil {
+		sr.streams[key] = make(map[*stream]struct{})
+	}
+	sr.streams[key][s] = struct{}{}
+}
+
+func (sr *StreamRegistry) remove(key string, s *stream) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	delete(sr.streams[key], s)
+	if len(sr.streams[key]) == 0 {
+		delete(sr.streams, key)
+	}
+}
+
+// Close 关闭会话的所有长连接，返回关闭的数量
+func (sr *StreamRegistry) Close(key string) int {
+	sr.mu.Lock()
+	streams := sr.streams[key]
+	delete(sr.streams, key)
+	sr.mu.Unlock()
+	for s := range streams {
+		s.close()
+	}
+	return len(streams)
+}
+
+// CloseAll 关闭所有长连接（优雅关闭时调用，避免 SSE 请求阻塞关闭、WebSocket 连接被直接断开）
+func (sr *StreamRegistry) CloseAll() {
+	sr.mu.Lock()
+	all := sr.streams
+	sr.streams = make(map[string]map[*stream]struct{})
+	sr.mu.Unlock()
+	for _, streams := range all {
+		for s := range streams {
+			s.close()
+		}
+	}
+}
+
+// stream 一个进行中的长连接：SSE 通过取消请求上下文关闭，WebSocket 通过关闭升级后的连接关闭
+type stream struct {
+	cancel context.CancelFunc
+	idle   time.Duration
+	timer  *time.Timer // SSE 空闲计时，每次写响应时重置
+
+	mu     sync.Mutex
+	conn   net.Conn
+	closed bool
+}
+
+func (s *stream) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	s.cancel()
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	if s.conn != nil {
+		s.conn.Close()
+	}
+}
+
+// trackStream 登记长连接并设置空闲超时，返回包装后的 ResponseWriter、请求和结束时调用的清理函数
+func (sr *StreamRegistry) trackStream(w http.ResponseWriter, r *http.Request, key string, idle time.Duration) (http.ResponseWriter, *http.Request, func()) {
+	ctx, cancel := context.WithCancel(r.Context())
+	s := &stream{cancel: cancel, idle: idle}
+	if idle > 0 {
+		s.timer = time.AfterFunc(idle, s.close)
+	}
+	if key != "" {
+		sr.add(key, s)
+	}
+	done := func() {
+		if key != "" {
+			sr.remove(key, s)
+		}
+		if s.timer != nil {
+			s.timer.Stop()
+		}
+		cancel()
+	}
+	return &streamWriter{ResponseWriter: w, s: s}, r.WithContext(ctx), done
+}
+
+// streamWriter 重置空闲计时，并在协议升级时接管连接
+type streamWriter struct {
+	http.ResponseWriter
+	s *stream
+}
+
+func (sw *streamWriter) Write(b []byte) (int, error) {
+	if sw.s.timer != nil {
+		sw.s.timer.Reset(sw.s.idle)
+	}
+	return sw.ResponseWriter.Write(b)
+}
+
+func (sw *streamWriter) Flush() {
+	if f, ok := sw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack 升级后的连接改由 idleConn 控制空闲超时，登出时关闭该连接
+func (sw *streamWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := sw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("底层 ResponseWriter 不支持 Hijack")
+	}
+	conn, brw, err := hj.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	s := sw.s
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		conn.Close()
+		return nil, nil, fmt.Errorf("连接已关闭")
+	}
+	s.conn = &idleConn{Conn: conn, idle: s.idle}
+	if s.idle > 0 {
+		conn.SetDeadline(time.Now().Add(s.idle))
+	}
+	return s.conn, brw, nil
+}
+
+func (sw *streamWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+// idleConn 任一方向有数据时延长读写期限，双向都空闲超过 idle 时读写失败，代理随即关闭两端连接
+type idleConn struct {
+	net.Conn
+	idle time.Duration
+}
+
+func (c *idleConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.extend()
+	}
+	return n, err
+}
+
+func (c *idleConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		c.extend()
+	}
+	return n, err
+}
+
+func (c *idleConn) extend() {
+	if c.idle > 0 {
+		c.Conn.SetDeadline(time.Now().Add(c.idle))
+	}
+}
@@ -0,0 +1,306 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+	"cas-gateway/auth"
+	"cas-gateway/models"
+	"cas-gateway/proxy"
+)
+
+// fakeProvider 测试用认证提供者，ticket 为 ST-ok 时验证成功
+type fakeProvider struct{}
+
+func (fakeProvider) GetLoginURL(serviceURL string, opts auth.LoginOptions) string {
+	return "https://cas.test/login?service=" + url.QueryEscape(serviceURL)
+}
+
+func (fakeProvider) GetLogoutURL(serviceURL string) string {
+	return "https://cas.test/logout?service=" + url.QueryEscape(serviceURL)
+}
+
+func (fakeProvider) ValidateTicket(ctx context.Context, ticket, serviceURL string, opts auth.LoginOptions) (*auth.UserInfo, error) {
+	if ticket != "ST-ok" {
+		return nil, &auth.ValidationError{Code: "INVALID_TICKET", Description: "ticket无效"}
+	}
+	return &auth.UserInfo{Oaid: "alice"}, nil
+}
+
+func (fakeProvider) ExtractTicket(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	return u.Query().Get("ticket"), nil
+}
+
+func (p fakeProvider) IsLoginPath(rawURL string) bool {
+	ticket, _ := p.ExtractTicket(rawURL)
+	return ticket != ""
+}
+
+func (fakeProvider) BuildServiceURL(r *http.Request, path string) string {
+	return "http://" + r.Host + path
+}
+
+func (fakeProvider) Available() (bool, time.Duration) {
+	return true, 0
+}
+
+// newStreamBackend 后端：/ws 升级后按行回显，/sse 先发送一个事件，收到 release 后再发送第二个
+func newStreamBackend(t *testing.T, release <-chan struct{}) *httptest.Server {
+	t.Helper()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ws":
+			if r.Header.Get("X-User") != "alice" {
+				http.Error(w, "missing user", http.StatusForbidden)
+				return
+			}
+			conn, brw, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n")
+			brw.Flush()
+			for {
+				line, err := brw.ReadString('\n')
+				if err != nil {
+					return
+				}
+				brw.WriteString(line)
+				brw.Flush()
+			}
+		case "/sse":
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "data: 1\n\n")
+			w.(http.Flusher).Flush()
+			select {
+			case <-release:
+			case <-r.Context().Done():
+				return
+			}
+			fmt.Fprint(w, "data: 2\n\n")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(backend.Close)
+	return backend
+}
+
+// newStreamGateway 按 newGateway 的方式组装认证中间件、登出端点和代理，外层加上 main 中的公共中间件
+func newStreamGateway(t *testing.T, backend string, idle time.Duration) *httptest.Server {
+	t.Helper()
+	route := &models.RouteConfig{Name: "app", Path: "/app", Target: backend, StreamIdleTimeout: idle}
+	pm, err := proxy.NewProxyManager(route, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &models.ServerConfig{SessionKey: strings.Repeat("k", 32)}
+	am := NewAuthMiddleware(server, pm, fakeProvider{}, nil, NewStreamRegistry(), nil)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/logout", am.HandleLogout)
+	mux.Handle("/", pm.GetProxy())
+
+	var handler http.Handler = am.Handler(mux)
+	handler = MetricsHandler(handler)
+	handler = Forwarded(nil, nil, handler)
+	handler = RequestID(nil, handler)
+	gw := httptest.NewServer(handler)
+	t.Cleanup(gw.Close)
+	return gw
+}
+
+var noRedirect = &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+	return http.ErrUseLastResponse
+}}
+
+// loginCookie 通过 ticket 回调登录，返回会话 Cookie
+func loginCookie(t *testing.T, gw string) string {
+	t.Helper()
+	resp, err := noRedirect.Get(gw + "/app/?ticket=ST-ok")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("登录回调状态码 = %d，期望 302", resp.StatusCode)
+	}
+	for _, c := range resp.Cookies() {
+		if c.Name == SessionName {
+			return c.Name + "=" + c.Value
+		}
+	}
+	t.Fatal("登录回调没有设置会话Cookie")
+	return ""
+}
+
+// dialUpgrade 发送 WebSocket 升级请求，返回连接、读取器和响应
+func dialUpgrade(t *testing.T, gw, cookie string) (net.Conn, *bufio.Reader, *http.Response) {
+	t.Helper()
+	u, _ := url.Parse(gw)
+	conn, err := net.Dial("tcp", u.Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	req := "GET /app/ws HTTP/1.1\r\nHost: " + u.Host + "\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n"
+	if cookie != "" {
+		req += "Cookie: " + cookie + "\r\n"
+	}
+	if _, err := io.WriteString(conn, req+"\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, br, resp
+}
+
+// echo 发送一行并读取回显
+func echo(t *testing.T, conn net.Conn, br *bufio.Reader, msg string) {
+	t.Helper()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.WriteString(conn, msg+"\n"); err != nil {
+		t.Fatal(err)
+	}
+	line, err := br.ReadString('\n')
+	if err != nil || line != msg+"\n" {
+		t.Fatalf("回显 = %q, %v，期望 %q", line, err, msg)
+	}
+}
+
+// expectClosed 等待网关关闭连接（读到 EOF 或连接错误，而不是客户端读超时）
+func expectClosed(t *testing.T, conn net.Conn, br *bufio.Reader, within time.Duration) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(within))
+	_, err := br.ReadString('\n')
+	if err == nil {
+		t.Fatal("连接未关闭，仍读到数据")
+	}
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("%s 内连接未关闭", within)
+	}
+}
+
+func TestStreamUnauthenticatedUpgrade(t *testing.T) {
+	gw := newStreamGateway(t, newStreamBackend(t, nil).URL, 0)
+	_, _, resp := dialUpgrade(t, gw.URL, "")
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("状态码 = %d，期望 401", resp.StatusCode)
+	}
+	if loc := resp.Header.Get("Location"); loc != "" {
+		t.Fatalf("未登录的升级请求不应跳转，Location = %q", loc)
+	}
+}
+
+func TestStreamAuthenticatedUpgrade(t *testing.T) {
+	gw := newStreamGateway(t, newStreamBackend(t, nil).URL, 0)
+	conn, br, resp := dialUpgrade(t, gw.URL, loginCookie(t, gw.URL))
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("状态码 = %d，期望 101", resp.StatusCode)
+	}
+	echo(t, conn, br, "hello")
+	echo(t, conn, br, "world")
+}
+
+func TestStreamClosedOnLogout(t *testing.T) {
+	gw := newStreamGateway(t, newStreamBackend(t, nil).URL, 0)
+	cookie := loginCookie(t, gw.URL)
+	conn, br, resp := dialUpgrade(t, gw.URL, cookie)
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("状态码 = %d，期望 101", resp.StatusCode)
+	}
+	echo(t, conn, br, "hello")
+
+	req, _ := http.NewRequest(http.MethodGet, gw.URL+"/logout", nil)
+	req.Header.Set("Cookie", cookie)
+	logout, err := noRedirect.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logout.Body.Close()
+	if logout.StatusCode != http.StatusFound {
+		t.Fatalf("登出状态码 = %d，期望 302", logout.StatusCode)
+	}
+	expectClosed(t, conn, br, 5*time.Second)
+}
+
+func TestStreamIdleTimeout(t *testing.T) {
+	gw := newStreamGateway(t, newStreamBackend(t, nil).URL, 200*time.Millisecond)
+	conn, br, resp := dialUpgrade(t, gw.URL, loginCookie(t, gw.URL))
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("状态码 = %d，期望 101", resp.StatusCode)
+	}
+	// 有数据往来时不超时
+	for i := 0; i < 3; i++ {
+		echo(t, conn, br, "ping")
+		time.Sleep(100 * time.Millisecond)
+	}
+	expectClosed(t, conn, br, 5*time.Second)
+}
+
+func TestStreamSSEFlush(t *testing.T) {
+	release := make(chan struct{})
+	gw := newStreamGateway(t, newStreamBackend(t, release).URL, 0)
+	req, _ := http.NewRequest(http.MethodGet, gw.URL+"/app/sse", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Cookie", loginCookie(t, gw.URL))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("状态码 = %d，期望 200", resp.StatusCode)
+	}
+
+	// 后端写出第一个事件后阻塞，网关必须立即转发，不能等响应结束
+	lines := make(chan string)
+	go func() {
+		br := bufio.NewReader(resp.Body)
+		for {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				close(lines)
+				return
+			}
+			lines <- line
+		}
+	}()
+	for _, want := range []string{"data: 1\n", "\n"} {
+		select {
+		case line := <-lines:
+			if line != want {
+				t.Fatalf("读到 %q，期望 %q", line, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("第一个事件未刷新到客户端")
+		}
+	}
+	close(release)
+	select {
+	case line := <-lines:
+		if line != "data: 2\n" {
+			t.Fatalf("读到 %q，期望第二个事件", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("第二个事件未刷新到客户端")
+	}
+}
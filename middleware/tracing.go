@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"cas-gateway/reqinfo"
+	"cas-gateway/tracing"
+)
+
+// Tracing 为每个请求创建服务端 span，沿用请求头中的 traceparent；需放在 RequestID 之内、访问日志之外
+func Tracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := tracing.Extract(r.Context(), r.Header)
+		ctx, span := tracing.Start(ctx, fmt.Sprintf("HTTP %s", r.Method), tracing.SpanKindServer)
+		if span == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		defer span.End()
+
+		info := reqinfo.FromContext(ctx)
+		if info != nil {
+			info.TraceID = tracing.TraceIDFromContext(ctx)
+			span.SetAttr("request.id", info.RequestID)
+		}
+		span.SetAttr("http.request.method", r.Method)
+		span.SetAttr("url.path", r.URL.Path)
+		span.SetAttr("client.address", clientIP(r))
+
+		rec := newResponseRecorder(w)
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		status := rec.Status()
+		span.SetAttr("http.response.status_code", status)
+		if info != nil {
+			span.SetAttr("http.route", info.Route)
+			if info.User != "" {
+				span.SetAttr("enduser.id", info.User)
+			}
+		}
+		if status >= http.StatusInternalServerError {
+			span.SetError(fmt.Errorf("%d %s", status, http.StatusText(status)))
+		}
+	})
+}
@@ -1,29 +1,273 @@
 package models
 
+import "time"
+
 // ServerConfig 服务器配置
 type ServerConfig struct {
 	Port       int    `yaml:"port"`
 	SessionKey string `yaml:"session_key"`
+
+	// TrustedProxies 可信代理 CIDR 列表，仅信任来自这些地址的 X-Request-ID 等请求头
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	// PreStopDelay 收到退出信号后 /health 返回503、继续处理请求的时长，用于负载均衡器摘流，默认为 0
+	PreStopDelay time.Duration `yaml:"pre_stop_delay"`
+	// ShutdownTimeout 停止接受新连接后等待处理中请求完成的最长时间，默认为 30s
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// WatchConfig 监听配置文件变更并自动重载（SIGHUP 始终可触发重载）
+	WatchConfig bool `yaml:"watch_config"`
+
+	TLS TLSConfig `yaml:"tls"` // 可选，HTTPS 监听
+
+	ProxyProtocol ProxyProtocolConfig `yaml:"proxy_protocol"` // 可选，四层负载均衡器的 PROXY 协议
+}
+
+// ProxyProtocolConfig PROXY 协议（v1/v2）配置，用于 HAProxy、NLB 等不添加 HTTP 请求头的四层负载均衡器
+type ProxyProtocolConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// AllowedCIDRs 发送 PROXY 协议头的负载均衡器地址，来自这些地址的连接必须带协议头，其他连接不解析
+	AllowedCIDRs []string `yaml:"allowed_cidrs"`
+	// HeaderTimeout 读取协议头的超时时间，默认为 5s
+	HeaderTimeout time.Duration `yaml:"header_timeout"`
+}
+
+// TLSConfig 服务端 TLS 配置
+type TLSConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	CertFile string `yaml:"cert_file"` // 默认证书
+	KeyFile  string `yaml:"key_file"`
+	// Certificates 额外证书，按客户端 SNI 选择（用于多个域名）
+	Certificates []CertificateConfig `yaml:"certificates"`
+
+	MinVersion   string   `yaml:"min_version"`   // 可选，1.2（默认）或 1.3
+	CipherSuites []string `yaml:"cipher_suites"` // 可选，TLS 1.2 加密套件名称列表，默认使用 Go 的安全套件
+
+	// HTTPRedirectPort 可选，在该端口监听 HTTP 并 301 跳转到 HTTPS
+	HTTPRedirectPort int `yaml:"http_redirect_port"`
+	// ReloadInterval 检查证书文件变更的间隔，默认为 1m
+	ReloadInterval time.Duration `yaml:"reload_interval"`
+}
+
+// CertificateConfig 证书和私钥文件
+type CertificateConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+// AllCertificates 返回默认证书和额外证书，默认证书在前
+func (c *TLSConfig) AllCertificates() []CertificateConfig {
+	var all []CertificateConfig
+	if c.CertFile != "" || c.KeyFile != "" {
+		all = append(all, CertificateConfig{CertFile: c.CertFile, KeyFile: c.KeyFile})
+	}
+	return append(all, c.Certificates...)
 }
 
 // RouteConfig 路由配置
 type RouteConfig struct {
-	Name   string `yaml:"name"`
-	Path   string `yaml:"path"`
-	Target string `yaml:"target"`
+	Name   string        `yaml:"name"`
+	Path   string        `yaml:"path"`
+	Target string        `yaml:"target"`
+	Renew  []RenewConfig `yaml:"renew"` // 可选，需要强制重新认证的敏感路径
+
+	// PublicURL 可选，网关对外访问地址（如 https://finops.example.com），设置后 CAS service 地址固定使用该地址，不再取自请求
+	PublicURL string `yaml:"public_url"`
+
+	// Auth 认证模式：required（默认，必须登录）或 optional（已有CAS会话时识别用户，否则匿名访问）
+	Auth string `yaml:"auth"`
+	// OptionalPaths 可选认证的路径前缀，仅在 Auth 为 required 时有意义
+	OptionalPaths []string `yaml:"optional_paths"`
+
+	TLS ClientTLSConfig `yaml:"tls"` // 可选，访问 HTTPS 后端的 TLS 配置
+
+	// Targets 可选，其他后端地址，与 Target 组成后端池轮询转发
+	Targets []string `yaml:"targets"`
+	// Retries 幂等请求（GET、HEAD 等无请求体的请求）转发失败时换其他后端重试的次数，默认 0（不重试），不超过其他后端数量
+	Retries int `yaml:"retries"`
+
+	// 后端超时，均为可选
+	DialTimeout           time.Duration `yaml:"dial_timeout"`            // 建立连接超时，默认 5s
+	TLSHandshakeTimeout   time.Duration `yaml:"tls_handshake_timeout"`   // TLS 握手超时，默认 10s
+	ResponseHeaderTimeout time.Duration `yaml:"response_header_timeout"` // 等待响应头超时，默认 60s
+
+	// FlushInterval 可选，转发响应时的刷新间隔，-1 表示每次写入后立即刷新；SSE（text/event-stream）始终立即刷新
+	FlushInterval time.Duration `yaml:"flush_interval"`
+	// StreamIdleTimeout 可选，WebSocket/SSE 长连接双向都没有数据的最长时间，默认 10m，-1 表示不限制
+	StreamIdleTimeout time.Duration `yaml:"stream_idle_timeout"`
+
+	Maintenance MaintenanceConfig `yaml:"maintenance"` // 可选，维护模式
+	RateLimits  []RateLimitConfig `yaml:"rate_limits"` // 可选，限流规则，匹配的规则都会生效
+
+	Logout LogoutConfig `yaml:"logout"` // 可选，/logout 登出配置
+
+	// IPRules 可选，客户端IP访问规则，在认证之前检查，匹配的规则都需要通过
+	IPRules []IPRuleConfig `yaml:"ip_rules"`
+
+	// ErrorPages 可选，自定义错误页文件（按状态码：403 IP规则拒绝，502/503/504 转发失败），.json 文件按 JSON 返回，其他按 HTML 返回
+	ErrorPages map[int]string `yaml:"error_pages"`
+}
+
+// MaintenanceConfig 路由维护模式：开启后除白名单外的请求返回 503 维护页面
+// 以下任一条件开启维护：enabled 为 true、flag_file 存在、通过管理端点开启（管理端点设置优先）
+type MaintenanceConfig struct {
+	Enabled    bool          `yaml:"enabled"`
+	FlagFile   string        `yaml:"flag_file"`   // 可选，该文件存在时开启维护
+	AllowUsers []string      `yaml:"allow_users"` // 可选，维护期间仍可访问的用户（oaid）
+	AllowIPs   []string      `yaml:"allow_ips"`   // 可选，维护期间仍可访问的客户端 IP/CIDR
+	RetryAfter time.Duration `yaml:"retry_after"` // 可选，Retry-After 响应头，默认 5m
+	Message    string        `yaml:"message"`     // 可选，维护页面说明文字，默认使用内置文本
+}
+
+// LogoutConfig 登出配置
+type LogoutConfig struct {
+	// AllowedRedirects 允许的登出后跳转地址（协议和主机相同、路径按段前缀匹配），网关自身地址始终允许
+	AllowedRedirects []string `yaml:"allowed_redirects"`
+	// Confirm GET 请求时显示确认页面，提交（POST）后才登出，防止第三方页面通过链接、图片触发登出
+	Confirm bool `yaml:"confirm"`
+}
+
+// IPRuleConfig 客户端IP访问规则，客户端IP在 deny 中或 allow 非空且不在 allow 中时拒绝访问
+type IPRuleConfig struct {
+	Path  string   `yaml:"path"`  // 可选，路径前缀，为空时作用于整个路由
+	Allow []string `yaml:"allow"` // 允许的 IP/CIDR，为空时不限制
+	Deny  []string `yaml:"deny"`  // 拒绝的 IP/CIDR，优先于 allow
+}
+
+// RateLimitConfig 令牌桶限流规则
+type RateLimitConfig struct {
+	Path   string  `yaml:"path"`   // 可选，路径前缀，为空时作用于整个路由
+	Key    string  `yaml:"key"`    // 限流维度：user（默认，未登录时按IP）、ip、token（按客户端IP和 API token，没有时按IP）
+	Rate   float64 `yaml:"rate"`   // 每秒补充的令牌数（平均每秒允许的请求数）
+	Burst  int     `yaml:"burst"`  // 可选，桶容量（允许的突发请求数），默认为 rate 向上取整
+	Header string  `yaml:"header"` // 可选，key 为 token 时读取 API token 的请求头，默认为 Authorization
+}
+
+// 限流维度
+const (
+	RateLimitKeyUser  = "user"
+	RateLimitKeyIP    = "ip"
+	RateLimitKeyToken = "token"
+)
+
+// AllTargets 返回后端池中的所有地址，Target 在前
+func (r *RouteConfig) AllTargets() []string {
+	return append([]string{r.Target}, r.Targets...)
+}
+
+// ClientTLSConfig 网关作为客户端访问后端或CAS服务器时的 TLS 配置
+type ClientTLSConfig struct {
+	CAFile     string `yaml:"ca_file"`     // 可选，CA证书（PEM），配置后只信任该CA签发的服务器证书
+	CertFile   string `yaml:"cert_file"`   // 可选，双向TLS客户端证书
+	KeyFile    string `yaml:"key_file"`    // 可选，客户端证书私钥
+	ServerName string `yaml:"server_name"` // 可选，覆盖校验证书和 SNI 使用的服务器名称
+	// InsecureSkipVerify 跳过服务器证书校验，仅用于开发环境
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify"`
+}
+
+// 路由认证模式
+const (
+	AuthModeRequired = "required"
+	AuthModeOptional = "optional"
+)
+
+// RenewConfig 强制重新认证（CAS renew=true）规则
+type RenewConfig struct {
+	Path   string        `yaml:"path"`    // 路径前缀，如 "/finops/approve"
+	MaxAge time.Duration `yaml:"max_age"` // 认证时间超过该值时要求重新输入密码，如 "5m"；0 表示每次都要求（重新认证后回跳的请求放行一次）
 }
 
 // CASConfig CAS 认证配置
 type CASConfig struct {
 	BaseURL      string `yaml:"base_url"`
 	LoginPath    string `yaml:"login_path"`    // 可选，默认为 "/login"
+	LogoutPath   string `yaml:"logout_path"`   // 可选，默认为 "/cas2/logout"
 	ValidatePath string `yaml:"validate_path"` // 可选，默认为 "/p3/serviceValidate"
 	UseJSON      bool   `yaml:"use_json"`      // 是否使用JSON格式（添加format=json参数）
+
+	// 验证请求的 HTTP 客户端参数，均为可选
+	Timeout         time.Duration `yaml:"timeout"`           // 单次请求总超时，默认 10s
+	ConnectTimeout  time.Duration `yaml:"connect_timeout"`   // 建立连接超时，默认 3s
+	ReadTimeout     time.Duration `yaml:"read_timeout"`      // 发出请求后等待响应头的超时，默认 5s
+	Retries         int           `yaml:"retries"`           // 5xx 或网络错误时的重试次数，默认 0（不重试）
+	RetryBackoff    time.Duration `yaml:"retry_backoff"`     // 首次重试前的等待时间，之后每次翻倍，默认 200ms
+	MaxResponseSize int64         `yaml:"max_response_size"` // 响应体大小上限（字节），默认 1MB
+
+	// 熔断：连续失败（网络错误、超时、5xx）达到阈值后暂停请求CAS，显示登录服务不可用页面
+	BreakerThreshold    int           `yaml:"breaker_threshold"`     // 连续失败次数阈值，默认 5，-1 表示不启用熔断
+	BreakerOpenDuration time.Duration `yaml:"breaker_open_duration"` // 熔断持续时间，之后放行请求试探，默认 30s
+	HealthCheckInterval time.Duration `yaml:"health_check_interval"` // 有登录请求时探测CAS登录页的最小间隔，默认 10s
+
+	TLS ClientTLSConfig `yaml:"tls"` // 可选，访问CAS服务器的 TLS 配置
+}
+
+// AdminConfig 管理端点配置
+type AdminConfig struct {
+	Listen string `yaml:"listen"` // 独立监听地址，如 "127.0.0.1:9101"，为空时不启用
+	Token  string `yaml:"token"`  // 可选，请求需携带 Authorization: Bearer <token>
+}
+
+// PagesConfig 网关生成页面（错误页、登录不可用、维护、登出）的配置
+type PagesConfig struct {
+	// Dir 可选，自定义模板目录，其中的同名文件（如 base.html、error.html）覆盖内置模板
+	Dir string `yaml:"dir"`
+	// DefaultLang 客户端 Accept-Language 不是中文或英文时使用的语言，zh-CN（默认）或 en
+	DefaultLang string `yaml:"default_lang"`
+}
+
+// MetricsConfig Prometheus 指标配置
+type MetricsConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Path    string `yaml:"path"`   // 可选，默认为 "/metrics"
+	Listen  string `yaml:"listen"` // 可选，独立监听地址（如 ":9100"），为空时与网关共用端口
+}
+
+// LogConfig 日志配置
+type LogConfig struct {
+	Level  string `yaml:"level"`  // 可选，debug/info/warn/error，默认为 info
+	Format string `yaml:"format"` // 可选，text/json，默认为 text
+
+	// 以下两项只在通过 serve -logfile 输出到文件时生效
+	MaxSizeMB  int `yaml:"max_size_mb"` // 可选，单个文件大小上限（MB），默认为 100
+	MaxBackups int `yaml:"max_backups"` // 可选，保留的历史文件数，默认为 5
+}
+
+// AccessLogConfig 访问日志配置
+type AccessLogConfig struct {
+	Enabled    bool   `yaml:"enabled"`
+	Format     string `yaml:"format"`      // 可选，combined（默认）/common/json/template
+	Template   string `yaml:"template"`    // format 为 template 时使用的 text/template 模板
+	Output     string `yaml:"output"`      // 可选，stdout（默认）/stderr 或文件路径
+	MaxSizeMB  int    `yaml:"max_size_mb"` // 可选，输出到文件时单个文件大小上限（MB），默认为 100
+	MaxBackups int    `yaml:"max_backups"` // 可选，保留的历史文件数，默认为 5
+}
+
+// AuditConfig 认证审计日志配置
+type AuditConfig struct {
+	Enabled   bool   `yaml:"enabled"`
+	Path      string `yaml:"path"`       // 审计日志文件（JSONL，只追加），如 /var/log/cas-gateway/audit.jsonl
+	HashChain bool   `yaml:"hash_chain"` // 可选，启用哈希链用于检测篡改
+}
+
+// TracingConfig 分布式追踪配置（W3C traceparent 传播，OTLP 导出）
+type TracingConfig struct {
+	Enabled     bool              `yaml:"enabled"`
+	ServiceName string            `yaml:"service_name"` // 可选，默认为 "cas-gateway"
+	Exporter    string            `yaml:"exporter"`     // otlp-http/otlp-grpc/stdout/file
+	Endpoint    string            `yaml:"endpoint"`     // OTLP 接收地址，如 "http://otel-collector:4318"（gRPC 为 4317）
+	Headers     map[string]string `yaml:"headers"`      // 可选，OTLP 附加请求头或 gRPC metadata（如认证）
+	Path        string            `yaml:"path"`         // file 导出器的输出文件
+	SampleRatio float64           `yaml:"sample_ratio"` // 可选，新追踪的采样比例（0~1），默认为 1
 }
 
 // Config 主配置结构
 type Config struct {
-	Server ServerConfig `yaml:"server"`
-	CAS    CASConfig    `yaml:"cas"`
-	Route  RouteConfig  `yaml:"route"` // 路由配置（单个路由）
+	Server    ServerConfig    `yaml:"server"`
+	CAS       CASConfig       `yaml:"cas"`
+	Route     RouteConfig     `yaml:"route"` // 路由配置（单个路由）
+	Pages     PagesConfig     `yaml:"pages"`
+	Admin     AdminConfig     `yaml:"admin"`
+	Metrics   MetricsConfig   `yaml:"metrics"`
+	Log       LogConfig       `yaml:"log"`
+	AccessLog AccessLogConfig `yaml:"access_log"`
+	Audit     AuditConfig     `yaml:"audit"`
+	Tracing   TracingConfig   `yaml:"tracing"`
 }
@@ -0,0 +1,86 @@
+package netutil
+
+import (
+	"net"
+	"strings"
+)
+
+// ForwardedElement RFC 7239 Forwarded 请求头中的一个代理节点
+type ForwardedElement struct {
+	For   string // 请求来源（客户端或上一级代理），已去除引号
+	Host  string // 该节点收到的 Host
+	Proto string // 该节点收到请求的协议（http/https）
+}
+
+// ParseForwarded 解析 Forwarded 请求头（多个请求头按顺序合并），第一个元素最靠近客户端
+func ParseForwarded(values []string) []ForwardedElement {
+	var elems []ForwardedElement
+	for _, v := range values {
+		for _, part := range splitQuoted(v, ',') {
+			var e ForwardedElement
+			for _, pair := range splitQuoted(part, ';') {
+				key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok {
+					continue
+				}
+				value = strings.Trim(strings.TrimSpace(value), `"`)
+				switch strings.ToLower(strings.TrimSpace(key)) {
+				case "for":
+					e.For = value
+				case "host":
+					e.Host = value
+				case "proto":
+					e.Proto = strings.ToLower(value)
+				}
+			}
+			elems = append(elems, e)
+		}
+	}
+	return elems
+}
+
+// splitQuoted 按分隔符拆分，忽略引号内的分隔符
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	inQuote := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			inQuote = !inQuote
+		case sep:
+			if !inQuote {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// ParseNodeIP 解析 X-Forwarded-For 或 Forwarded for= 中的地址，支持 IPv6 方括号和端口；
+// unknown、混淆标识（_xxx）等无法解析的值返回 nil
+func ParseNodeIP(node string) net.IP {
+	node = strings.TrimSpace(node)
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		node = host
+	}
+	return net.ParseIP(strings.Trim(node, "[]"))
+}
+
+// ValidHost 判断转发头中的 Host 是否为合法的主机名或 IP（可带端口），防止注入路径、用户信息等
+func ValidHost(host string) bool {
+	if host == "" || len(host) > 255 {
+		return false
+	}
+	for i := 0; i < len(host); i++ {
+		c := host[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '.', c == '-', c == '_', c == ':', c == '[', c == ']':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+package netutil
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// IPSet CIDR 列表，用于可信代理、IP 白名单等判断
+type IPSet []*net.IPNet
+
+// ParseIPSet 解析 CIDR 列表，单个 IP 视为 /32（IPv6 为 /128）
+func ParseIPSet(cidrs []string) (IPSet, error) {
+	set := make(IPSet, 0, len(cidrs))
+	for _, c := range cidrs {
+		c = strings.TrimSpace(c)
+		if !strings.Contains(c, "/") {
+			ip := net.ParseIP(c)
+			if ip == nil {
+				return nil, fmt.Errorf("IP地址无效: %q", c)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			set = append(set, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, fmt.Errorf("CIDR无效: %q", c)
+		}
+		set = append(set, ipNet)
+	}
+	return set, nil
+}
+
+// Contains 判断 IP 是否在列表中
+func (s IPSet) Contains(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range s {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoteIP 解析 r.RemoteAddr 形式的地址（host:port），返回 IP
+func RemoteIP(remoteAddr string) net.IP {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	return net.ParseIP(host)
+}
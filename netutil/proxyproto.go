@@ -0,0 +1,230 @@
+package netutil
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultProxyHeaderTimeout 读取 PROXY 协议头的默认超时时间
+const DefaultProxyHeaderTimeout = 5 * time.Second
+
+// proxyV1MaxLen v1 协议头最大长度（含 CRLF）
+const proxyV1MaxLen = 107
+
+// proxyV2Signature v2 协议头的固定前缀
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// ErrNoProxyHeader 连接没有以 PROXY 协议头开始
+var ErrNoProxyHeader = errors.New("缺少 PROXY 协议头")
+
+// ProxyListener 解析 PROXY 协议头的监听器，来自 allowed 地址的连接必须带协议头，
+// 连接的 RemoteAddr 替换为协议头中的客户端地址；其他连接原样返回
+type ProxyListener struct {
+	net.Listener
+	allowed IPSet
+	timeout time.Duration
+}
+
+// NewProxyListener 创建 PROXY 协议监听器，timeout 为 0 时使用默认值
+func NewProxyListener(ln net.Listener, allowed IPSet, timeout time.Duration) *ProxyListener {
+	if timeout <= 0 {
+		timeout = DefaultProxyHeaderTimeout
+	}
+	return &ProxyListener{Listener: ln, allowed: allowed, timeout: timeout}
+}
+
+// Accept 接受连接，协议头在首次读取或获取地址时解析，不阻塞 Accept
+func (l *ProxyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !l.allowed.Contains(RemoteIP(conn.RemoteAddr().String())) {
+		return conn, nil
+	}
+	return &proxyConn{Conn: conn, br: bufio.NewReader(conn), timeout: l.timeout}, nil
+}
+
+// proxyConn 带 PROXY 协议头的连接
+type proxyConn struct {
+	net.Conn
+	br      *bufio.Reader
+	timeout time.Duration
+
+	once       sync.Once
+	err        error
+	remoteAddr net.Addr
+	localAddr  net.Addr
+}
+
+// init 读取协议头，出错时直接关闭连接，后续读取都返回该错误
+func (c *proxyConn) init() {
+	c.once.Do(func() {
+		c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+		src, dst, err := ReadProxyHeader(c.br)
+		c.Conn.SetReadDeadline(time.Time{})
+		if err != nil {
+			slog.Warn("读取 PROXY 协议头失败，关闭连接", "remote_addr", c.Conn.RemoteAddr().String(), "error", err)
+			c.err = err
+			c.Conn.Close()
+			return
+		}
+		c.remoteAddr, c.localAddr = src, dst
+	})
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.br.Read(b)
+}
+
+// RemoteAddr 返回协议头中的客户端地址，LOCAL/UNKNOWN 或解析失败时为负载均衡器地址
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.init()
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr 返回协议头中的目标地址
+func (c *proxyConn) LocalAddr() net.Addr {
+	c.init()
+	if c.localAddr != nil {
+		return c.localAddr
+	}
+	return c.Conn.LocalAddr()
+}
+
+// ReadProxyHeader 读取并解析 PROXY 协议 v1（文本）或 v2（二进制）头，只消费协议头本身的字节；
+// LOCAL 命令（负载均衡器健康检查）和 UNKNOWN/UNSPEC 地址族返回 nil 地址
+func ReadProxyHeader(br *bufio.Reader) (src, dst net.Addr, err error) {
+	if sig, err := br.Peek(len(proxyV2Signature)); err == nil && bytes.Equal(sig, proxyV2Signature) {
+		return readProxyV2(br)
+	}
+	if prefix, err := br.Peek(6); err == nil && string(prefix) == "PROXY " {
+		return readProxyV1(br)
+	}
+	return nil, nil, ErrNoProxyHeader
+}
+
+// readProxyV1 解析 v1 协议头：PROXY TCP4|TCP6|UNKNOWN 源地址 目标地址 源端口 目标端口\r\n
+func readProxyV1(br *bufio.Reader) (net.Addr, net.Addr, error) {
+	var line []byte
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return nil, nil, fmt.Errorf("读取 PROXY v1 协议头失败: %w", err)
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+		if len(line) >= proxyV1MaxLen {
+			return nil, nil, errors.New("PROXY v1 协议头过长")
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, nil, errors.New("PROXY v1 协议头未以 CRLF 结束")
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil, nil
+	}
+	if len(fields) != 6 {
+		return nil, nil, fmt.Errorf("PROXY v1 协议头格式错误: %q", line)
+	}
+	var want4 bool
+	switch fields[1] {
+	case "TCP4":
+		want4 = true
+	case "TCP6":
+	default:
+		return nil, nil, fmt.Errorf("PROXY v1 协议不支持: %q", fields[1])
+	}
+	src, err := parseV1Addr(fields[2], fields[4], want4)
+	if err != nil {
+		return nil, nil, err
+	}
+	dst, err := parseV1Addr(fields[3], fields[5], want4)
+	if err != nil {
+		return nil, nil, err
+	}
+	return src, dst, nil
+}
+
+// parseV1Addr 解析 v1 协议头中的地址和端口
+func parseV1Addr(host, port string, want4 bool) (*net.TCPAddr, error) {
+	// TCP4 只接受点分十进制，TCP6 只接受冒号格式
+	ip := net.ParseIP(host)
+	if ip == nil || strings.Contains(host, ":") == want4 {
+		return nil, fmt.Errorf("PROXY v1 地址无效: %q", host)
+	}
+	// 端口为不带前导零的十进制数
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || (len(port) > 1 && port[0] == '0') {
+		return nil, fmt.Errorf("PROXY v1 端口无效: %q", port)
+	}
+	return &net.TCPAddr{IP: ip, Port: int(p)}, nil
+}
+
+// readProxyV2 解析 v2 协议头：签名(12) 版本/命令(1) 地址族/协议(1) 长度(2) 地址及 TLV(长度)
+func readProxyV2(br *bufio.Reader) (net.Addr, net.Addr, error) {
+	var hdr [16]byte
+	if _, err := io.ReadFull(br, hdr[:]); err != nil {
+		return nil, nil, fmt.Errorf("读取 PROXY v2 协议头失败: %w", err)
+	}
+	if hdr[12]>>4 != 2 {
+		return nil, nil, fmt.Errorf("PROXY v2 版本无效: %d", hdr[12]>>4)
+	}
+	command := hdr[12] & 0x0f
+	if command > 1 {
+		return nil, nil, fmt.Errorf("PROXY v2 命令无效: %d", command)
+	}
+	family, length := hdr[13], int(binary.BigEndian.Uint16(hdr[14:16]))
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(br, payload); err != nil {
+		return nil, nil, fmt.Errorf("读取 PROXY v2 地址失败: %w", err)
+	}
+	// LOCAL：负载均衡器自身发起的连接（如健康检查），使用连接本身的地址
+	if command == 0 {
+		return nil, nil, nil
+	}
+
+	var ipLen int
+	switch family >> 4 {
+	case 0x1: // AF_INET
+		ipLen = net.IPv4len
+	case 0x2: // AF_INET6
+		ipLen = net.IPv6len
+	default: // AF_UNSPEC、AF_UNIX：没有可用的IP地址
+		return nil, nil, nil
+	}
+	if family&0x0f != 0x1 && family&0x0f != 0x2 {
+		return nil, nil, fmt.Errorf("PROXY v2 传输协议无效: %#x", family)
+	}
+	if len(payload) < 2*ipLen+4 {
+		return nil, nil, errors.New("PROXY v2 地址长度不足")
+	}
+	srcIP := net.IP(append([]byte(nil), payload[:ipLen]...))
+	dstIP := net.IP(append([]byte(nil), payload[ipLen:2*ipLen]...))
+	srcPort := binary.BigEndian.Uint16(payload[2*ipLen:])
+	dstPort := binary.BigEndian.Uint16(payload[2*ipLen+2:])
+	// 其后的 TLV 扩展字段不使用，已随 payload 读取丢弃
+	return &net.TCPAddr{IP: srcIP, Port: int(srcPort)}, &net.TCPAddr{IP: dstIP, Port: int(dstPort)}, nil
+}
@@ -0,0 +1,217 @@
+package netutil
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// proxyV2 构造 v2 协议头，command 0 为 LOCAL、1 为 PROXY，family 为地址族/协议字节
+func proxyV2(command, family byte, payload []byte) []byte {
+	b := append([]byte(nil), proxyV2Signature...)
+	b = append(b, 0x20|command, family)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(payload)))
+	return append(b, payload...)
+}
+
+// v2Addrs 构造 v2 地址部分：源IP、目标IP、源端口、目标端口
+func v2Addrs(src, dst string, srcPort, dstPort uint16) []byte {
+	s, d := net.ParseIP(src), net.ParseIP(dst)
+	if s4 := s.To4(); s4 != nil {
+		s, d = s4, d.To4()
+	}
+	b := append(append([]byte(nil), s...), d...)
+	b = binary.BigEndian.AppendUint16(b, srcPort)
+	return binary.BigEndian.AppendUint16(b, dstPort)
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []byte
+		src, dst string // 期望的地址，空表示 nil
+		wantErr  bool
+	}{
+		{name: "v1 TCP4", input: []byte("PROXY TCP4 192.0.2.1 198.51.100.2 51234 443\r\n"), src: "192.0.2.1:51234", dst: "198.51.100.2:443"},
+		{name: "v1 TCP6", input: []byte("PROXY TCP6 2001:db8::1 2001:db8::2 51234 443\r\n"), src: "[2001:db8::1]:51234", dst: "[2001:db8::2]:443"},
+		{name: "v1 UNKNOWN", input: []byte("PROXY UNKNOWN\r\n")},
+		{name: "v1 UNKNOWN 带地址", input: []byte("PROXY UNKNOWN ffff:f...f:ffff ffff:f...f:ffff 65535 65535\r\n")},
+		{name: "v1 TCP4 使用 IPv6 地址", input: []byte("PROXY TCP4 2001:db8::1 198.51.100.2 1 2\r\n"), wantErr: true},
+		{name: "v1 TCP6 使用 IPv4 地址", input: []byte("PROXY TCP6 192.0.2.1 2001:db8::2 1 2\r\n"), wantErr: true},
+		{name: "v1 端口前导零", input: []byte("PROXY TCP4 192.0.2.1 198.51.100.2 0443 443\r\n"), wantErr: true},
+		{name: "v1 端口越界", input: []byte("PROXY TCP4 192.0.2.1 198.51.100.2 65536 443\r\n"), wantErr: true},
+		{name: "v1 缺少字段", input: []byte("PROXY TCP4 192.0.2.1 198.51.100.2 443\r\n"), wantErr: true},
+		{name: "v1 未以 CRLF 结束", input: []byte("PROXY TCP4 192.0.2.1 198.51.100.2 1 2\n"), wantErr: true},
+		{name: "v1 截断", input: []byte("PROXY TCP4 192.0.2.1 198.51"), wantErr: true},
+		{name: "v1 过长", input: []byte("PROXY TCP4 " + strings.Repeat("1", 200) + "\r\n"), wantErr: true},
+		{name: "v2 PROXY TCP4", input: proxyV2(1, 0x11, v2Addrs("192.0.2.1", "198.51.100.2", 51234, 443)), src: "192.0.2.1:51234", dst: "198.51.100.2:443"},
+		{name: "v2 PROXY TCP6", input: proxyV2(1, 0x21, v2Addrs("2001:db8::1", "2001:db8::2", 51234, 443)), src: "[2001:db8::1]:51234", dst: "[2001:db8::2]:443"},
+		{name: "v2 PROXY 带 TLV", input: proxyV2(1, 0x11, append(v2Addrs("192.0.2.1", "198.51.100.2", 1, 2), 0x04, 0x00, 0x01, 0xff)), src: "192.0.2.1:1", dst: "198.51.100.2:2"},
+		{name: "v2 LOCAL", input: proxyV2(0, 0x00, nil)},
+		{name: "v2 LOCAL 带地址", input: proxyV2(0, 0x11, v2Addrs("192.0.2.1", "198.51.100.2", 1, 2))},
+		{name: "v2 UNSPEC", input: proxyV2(1, 0x00, nil)},
+		{name: "v2 版本无效", input: append(append([]byte(nil), proxyV2Signature...), 0x11, 0x11, 0, 0), wantErr: true},
+		{name: "v2 命令无效", input: proxyV2(2, 0x11, v2Addrs("192.0.2.1", "198.51.100.2", 1, 2)), wantErr: true},
+		{name: "v2 传输协议无效", input: proxyV2(1, 0x13, v2Addrs("192.0.2.1", "198.51.100.2", 1, 2)), wantErr: true},
+		{name: "v2 地址长度不足", input: proxyV2(1, 0x21, v2Addrs("192.0.2.1", "198.51.100.2", 1, 2)), wantErr: true},
+		{name: "v2 截断", input: proxyV2(1, 0x11, v2Addrs("192.0.2.1", "198.51.100.2", 1, 2))[:20], wantErr: true},
+		{name: "没有协议头", input: []byte("GET / HTTP/1.1\r\n\r\n"), wantErr: true},
+		{name: "空", input: nil, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 协议头之后的数据属于应用层，不能被消费
+			br := bufio.NewReader(io.MultiReader(bytes.NewReader(tt.input), strings.NewReader("GET /")))
+			src, dst, err := ReadProxyHeader(br)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("期望错误，得到 src=%v dst=%v", src, dst)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("解析失败: %v", err)
+			}
+			if got := addrString(src); got != tt.src {
+				t.Errorf("src = %q，期望 %q", got, tt.src)
+			}
+			if got := addrString(dst); got != tt.dst {
+				t.Errorf("dst = %q，期望 %q", got, tt.dst)
+			}
+			if rest, _ := io.ReadAll(br); string(rest) != "GET /" {
+				t.Errorf("协议头之后剩余 %q，期望 %q", rest, "GET /")
+			}
+		})
+	}
+}
+
+func addrString(a net.Addr) string {
+	if a == nil {
+		return ""
+	}
+	return a.String()
+}
+
+func FuzzReadProxyHeader(f *testing.F) {
+	f.Add([]byte("PROXY TCP4 192.0.2.1 198.51.100.2 51234 443\r\n"))
+	f.Add([]byte("PROXY TCP6 2001:db8::1 2001:db8::2 51234 443\r\n"))
+	f.Add([]byte("PROXY UNKNOWN\r\n"))
+	f.Add(proxyV2(0, 0x00, nil))
+	f.Add(proxyV2(1, 0x11, v2Addrs("192.0.2.1", "198.51.100.2", 51234, 443)))
+	f.Add(proxyV2(1, 0x21, v2Addrs("2001:db8::1", "2001:db8::2", 51234, 443)))
+	f.Add([]byte("PROXY TCP4 192.0.2.1 198.51"))
+	f.Add(proxyV2(1, 0x11, v2Addrs("192.0.2.1", "198.51.100.2", 1, 2))[:20])
+	f.Add([]byte("PROXY TCP4 " + strings.Repeat("1", 200) + "\r\n"))
+	f.Add(proxyV2(1, 0x11, make([]byte, 0xffff)))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		br := bufio.NewReader(bytes.NewReader(data))
+		src, dst, err := ReadProxyHeader(br)
+		if err != nil {
+			if src != nil || dst != nil {
+				t.Fatalf("出错时返回了地址: %v %v", src, dst)
+			}
+			return
+		}
+		if (src == nil) != (dst == nil) {
+			t.Fatalf("源地址和目标地址应同时存在: %v %v", src, dst)
+		}
+		// 只消费协议头本身：v1 到第一个 CRLF 为止且不超过最大长度，v2 为固定头加声明的长度
+		rest, _ := io.ReadAll(br)
+		header := data[:len(data)-len(rest)]
+		if bytes.HasPrefix(data, proxyV2Signature) {
+			if want := 16 + int(binary.BigEndian.Uint16(data[14:16])); len(header) != want {
+				t.Fatalf("v2 消费了 %d 字节，期望 %d", len(header), want)
+			}
+		} else if len(header) > proxyV1MaxLen || !bytes.HasSuffix(header, []byte("\r\n")) || bytes.IndexByte(header, '\n') != len(header)-1 {
+			t.Fatalf("v1 协议头边界错误: %q", header)
+		}
+		for _, a := range []net.Addr{src, dst} {
+			if a == nil {
+				continue
+			}
+			tcp, ok := a.(*net.TCPAddr)
+			if !ok || (len(tcp.IP) != net.IPv4len && len(tcp.IP) != net.IPv6len) || tcp.Port < 0 || tcp.Port > 65535 {
+				t.Fatalf("地址无效: %#v", a)
+			}
+		}
+	})
+}
+
+// acceptOne 在 ProxyListener 上接受一个连接，客户端写入 data
+func acceptOne(t *testing.T, allowed []string, data string) (net.Conn, net.Conn) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	set, err := ParseIPSet(allowed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pl := NewProxyListener(ln, set, time.Second)
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	if _, err := io.WriteString(client, data); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := pl.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return client, conn
+}
+
+func TestProxyListenerRewritesAddr(t *testing.T) {
+	_, conn := acceptOne(t, []string{"127.0.0.1/32"}, "PROXY TCP4 192.0.2.1 198.51.100.2 51234 443\r\nGET /")
+	if got := conn.RemoteAddr().String(); got != "192.0.2.1:51234" {
+		t.Errorf("RemoteAddr = %q，期望 192.0.2.1:51234", got)
+	}
+	if got := conn.LocalAddr().String(); got != "198.51.100.2:443" {
+		t.Errorf("LocalAddr = %q，期望 198.51.100.2:443", got)
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "GET /" {
+		t.Fatalf("读取 = %q, %v，期望 %q", buf, err, "GET /")
+	}
+}
+
+func TestProxyListenerRejectsMissingHeader(t *testing.T) {
+	client, conn := acceptOne(t, []string{"127.0.0.1/32"}, "GET / HTTP/1.1\r\nHost: x\r\n\r\n")
+	if _, err := conn.Read(make([]byte, 16)); !errors.Is(err, ErrNoProxyHeader) {
+		t.Fatalf("读取错误 = %v，期望 %v", err, ErrNoProxyHeader)
+	}
+	if got := conn.RemoteAddr().String(); !strings.HasPrefix(got, "127.0.0.1:") {
+		t.Errorf("RemoteAddr = %q，期望负载均衡器地址", got)
+	}
+	// 网关关闭连接，客户端读到 EOF 或连接重置
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := client.Read(make([]byte, 1)); err == nil || errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("连接未关闭: %v", err)
+	}
+}
+
+func TestProxyListenerIgnoresOtherPeers(t *testing.T) {
+	// 不在 allowed 中的连接不解析协议头，数据原样读取
+	_, conn := acceptOne(t, []string{"192.0.2.0/24"}, "PROXY TCP4 192.0.2.1 198.51.100.2 1 2\r\n")
+	if got := conn.RemoteAddr().String(); !strings.HasPrefix(got, "127.0.0.1:") {
+		t.Errorf("RemoteAddr = %q，期望直接连接的对端", got)
+	}
+	buf := make([]byte, 6)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "PROXY " {
+		t.Fatalf("读取 = %q, %v，期望原始数据", buf, err)
+	}
+}
@@ -0,0 +1,130 @@
+package pages
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 支持的页面语言
+const (
+	LangZhCN = "zh-CN"
+	LangEn   = "en"
+)
+
+// messages 页面文本，按语言和键组织；页面标题和说明的键为 "<页面>.title"、"<页面>.message"，
+// 错误页在特定场景下的说明为 "<场景>.message"（见 Message* 常量）
+var messages = map[string]map[string]string{
+	LangZhCN: {
+		"request_id":  "请求ID",
+		"user":        "当前用户",
+		"retry_after": "请在 %d 秒后重试。",
+		"login_again": "重新登录",
+		"logout":      "退出登录",
+
+		"error.message":             "请稍后重试，如果问题持续出现，请联系管理员并提供下方的请求ID。",
+		"login_unavailable.title":   "登录服务暂时不可用",
+		"login_unavailable.message": "统一认证服务暂时无法访问，请稍后重试。已登录的用户不受影响。",
+		"maintenance.title":         "系统维护中",
+		"maintenance.message":       "系统正在维护，请稍后访问。",
+		"logout.title":              "已退出登录",
+		"logout.message":            "您已安全退出。",
+		"logout_confirm.title":      "退出登录",
+		"logout_confirm.message":    "确定要退出登录吗？退出后将同时退出统一认证，访问其他系统需要重新登录。",
+
+		"status.400": "请求无效",
+		"status.401": "未登录",
+		"status.403": "禁止访问",
+		"status.404": "页面不存在",
+		"status.405": "请求方法不允许",
+		"status.429": "请求过于频繁",
+		"status.500": "服务器内部错误",
+		"status.502": "后端服务错误",
+		"status.503": "服务暂时不可用",
+		"status.504": "后端服务响应超时",
+
+		"ip_denied.message":         "您当前的网络不允许访问该页面，请连接公司网络或 VPN 后重试，如有疑问请联系管理员并提供下方的请求ID。",
+		"logout_cross_site.message": "登出请求来自其他网站，已被拒绝。如需退出登录，请在本系统页面中点击退出。",
+	},
+	LangEn: {
+		"request_id":  "Request ID",
+		"user":        "Signed in as",
+		"retry_after": "Please try again in %d seconds.",
+		"login_again": "Sign in again",
+		"logout":      "Sign out",
+
+		"error.message":             "Please try again later. If the problem persists, contact the administrator with the request ID below.",
+		"login_unavailable.title":   "Login service unavailable",
+		"login_unavailable.message": "The single sign-on service is temporarily unreachable. Please try again later. Users who are already signed in are not affected.",
+		"maintenance.title":         "Under maintenance",
+		"maintenance.message":       "The system is under maintenance. Please come back later.",
+		"logout.title":              "Signed out",
+		"logout.message":            "You have been signed out.",
+		"logout_confirm.title":      "Sign out",
+		"logout_confirm.message":    "Are you sure you want to sign out? You will also be signed out of single sign-on and need to sign in again to access other systems.",
+
+		"ip_denied.message":         "Access from your network is not allowed. Please connect to the corporate network or VPN and try again, or contact the administrator with the request ID below.",
+		"logout_cross_site.message": "The sign-out request came from another website and was rejected. To sign out, use the sign-out button on this site.",
+	},
+}
+
+// text 返回指定语言的文本，缺失时依次回退到 fallback 语言和中文
+func text(lang, fallback, key string) string {
+	for _, l := range []string{lang, fallback, LangZhCN} {
+		if s, ok := messages[l][key]; ok {
+			return s
+		}
+	}
+	return ""
+}
+
+// statusTitle 返回状态码的标题，英文使用标准状态文本
+func statusTitle(lang, fallback string, status int) string {
+	if lang == LangEn {
+		return http.StatusText(status)
+	}
+	if s := text(lang, fallback, "status."+strconv.Itoa(status)); s != "" {
+		return s
+	}
+	return http.StatusText(status)
+}
+
+// labels 返回模板使用的界面文本（不含页面标题和说明）
+func labels(lang, fallback string) map[string]string {
+	m := make(map[string]string)
+	for _, key := range []string{"request_id", "user", "retry_after", "login_again", "logout"} {
+		m[key] = text(lang, fallback, key)
+	}
+	return m
+}
+
+// NegotiateLang 根据 Accept-Language 选择页面语言（zh-* 为中文，en-* 为英文），都不匹配时返回 def
+func NegotiateLang(acceptLanguage, def string) string {
+	type candidate struct {
+		lang string
+		q    float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		primary, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		switch primary {
+		case "zh":
+			candidates = append(candidates, candidate{LangZhCN, q})
+		case "en":
+			candidates = append(candidates, candidate{LangEn, q})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+	if len(candidates) > 0 && candidates[0].q > 0 {
+		return candidates[0].lang
+	}
+	return def
+}
@@ -0,0 +1,278 @@
+package pages
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"cas-gateway/models"
+	"cas-gateway/reqinfo"
+)
+
+// 页面名称，对应模板目录中的 <名称>.html
+const (
+	PageError            = "error"
+	PageLoginUnavailable = "login_unavailable"
+	PageMaintenance      = "maintenance"
+	PageLogout           = "logout"
+	PageLogoutConfirm    = "logout_confirm"
+)
+
+// 错误页的说明文本键，用于同一状态码在不同场景下给出不同提示
+const (
+	MessageIPDenied        = "ip_denied.message"         // 客户端IP被 route.ip_rules 拒绝
+	MessageLogoutCrossSite = "logout_cross_site.message" // 开启登出确认时拒绝跨站的登出请求
+)
+
+//go:embed templates/*.html
+var defaultTemplates embed.FS
+
+// Data 页面模板数据
+type Data struct {
+	Lang       string // 页面语言：zh-CN 或 en
+	Status     int
+	Title      string
+	Message    string
+	RequestID  string
+	User       string // 当前用户（oaid），未登录时为空
+	Route      string
+	RetryAfter int    // 建议重试等待秒数，0 表示不提示
+	URL        string // 页面中的链接（如重新登录地址、登出确认表单的提交地址）
+	MessageKey string // 说明文本的键，Message 为空时按当前语言取该键的文本
+	// T 当前语言的界面文本，如 {{.T.request_id}}
+	T map[string]string
+}
+
+// Set 已解析的页面模板集合，每次构建网关时加载并传给需要输出页面的中间件；nil 表示使用内置模板
+type Set struct {
+	pages       map[string]*template.Template
+	defaultLang string
+}
+
+// builtin 内置模板，只在 init 中赋值
+var builtin *Set
+
+func init() {
+	set, err := Load(&models.PagesConfig{})
+	if err != nil {
+		panic(fmt.Sprintf("pages: 内置模板无效: %v", err))
+	}
+	builtin = set
+}
+
+// Load 加载页面模板：内置模板为默认值，cfg.Dir 中的同名文件覆盖内置模板
+func Load(cfg *models.PagesConfig) (*Set, error) {
+	defaultLang := cfg.DefaultLang
+	switch defaultLang {
+	case "":
+		defaultLang = LangZhCN
+	case LangZhCN, LangEn:
+	default:
+		return nil, fmt.Errorf("pages.default_lang 无效: %q（可选值 zh-CN、en）", cfg.DefaultLang)
+	}
+
+	base, err := readTemplate(cfg.Dir, "base")
+	if err != nil {
+		return nil, err
+	}
+	set := &Set{pages: make(map[string]*template.Template), defaultLang: defaultLang}
+	for _, name := range []string{PageError, PageLoginUnavailable, PageMaintenance, PageLogout, PageLogoutConfirm} {
+		content, err := readTemplate(cfg.Dir, name)
+		if err != nil {
+			return nil, err
+		}
+		t, err := template.New(name).Parse(base)
+		if err == nil {
+			_, err = t.Parse(content)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("解析页面模板失败 [%s]: %w", name, err)
+		}
+		set.pages[name] = t
+	}
+	return set, nil
+}
+
+// readTemplate 优先读取自定义目录中的模板，不存在时使用内置模板
+func readTemplate(dir, name string) (string, error) {
+	file := name + ".html"
+	if dir != "" {
+		b, err := os.ReadFile(filepath.Join(dir, file))
+		if err == nil {
+			return string(b), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", fmt.Errorf("读取页面模板失败: %w", err)
+		}
+	}
+	b, err := defaultTemplates.ReadFile("templates/" + file)
+	if err != nil {
+		return "", fmt.Errorf("读取内置页面模板失败: %w", err)
+	}
+	return string(b), nil
+}
+
+// Render 渲染页面，自动补充语言、请求ID、用户、路由和界面文本；未设置标题和说明时使用默认文本
+func (set *Set) Render(w http.ResponseWriter, r *http.Request, page string, status int, data Data) {
+	if set == nil {
+		set = builtin
+	}
+	t, ok := set.pages[page]
+	if !ok {
+		t = set.pages[PageError]
+	}
+
+	data.Lang = NegotiateLang(r.Header.Get("Accept-Language"), set.defaultLang)
+	data.Status = status
+	if info := reqinfo.FromContext(r.Context()); info != nil {
+		data.RequestID = info.RequestID
+		data.Route = info.Route
+		if data.User == "" {
+			data.User = info.User
+		}
+	}
+	if data.Title == "" {
+		data.Title = text(data.Lang, set.defaultLang, page+".title")
+		if data.Title == "" {
+			data.Title = statusTitle(data.Lang, set.defaultLang, status)
+		}
+	}
+	if data.Message == "" && data.MessageKey != "" {
+		data.Message = text(data.Lang, set.defaultLang, data.MessageKey)
+	}
+	if data.Message == "" {
+		data.Message = text(data.Lang, set.defaultLang, page+".message")
+	}
+	data.T = labels(data.Lang, set.defaultLang)
+
+	var buf bytes.Buffer
+	if err := t.ExecuteTemplate(&buf, "base", data); err != nil {
+		// 自定义模板执行出错时退回纯文本，保证用户仍能看到状态和请求ID
+		slog.ErrorContext(r.Context(), "渲染页面失败", "page", page, "error", err)
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(status)
+		fmt.Fprintf(w, "%d %s\n", status, http.StatusText(status))
+		if data.RequestID != "" {
+			fmt.Fprintf(w, "请求ID: %s\n", data.RequestID)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Language", data.Lang)
+	w.Header().Add("Vary", "Accept-Language")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// Error 输出网关生成的错误页，附带请求ID便于用户反馈时引用；客户端偏好 JSON 时返回 JSON
+func (set *Set) Error(w http.ResponseWriter, r *http.Request, status int) {
+	if wantsJSON(r) {
+		writeJSON(w, r, status)
+		return
+	}
+	set.Render(w, r, PageError, status, Data{})
+}
+
+// ErrorMessage 输出带指定说明文本的错误页，key 为 Message* 常量；客户端偏好 JSON 时返回 JSON
+func (set *Set) ErrorMessage(w http.ResponseWriter, r *http.Request, status int, key string) {
+	if wantsJSON(r) {
+		writeJSON(w, r, status)
+		return
+	}
+	set.Render(w, r, PageError, status, Data{MessageKey: key})
+}
+
+// writeJSON 输出 JSON 格式的错误
+func writeJSON(w http.ResponseWriter, r *http.Request, status int) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Status    int    `json:"status"`
+		Error     string `json:"error"`
+		RequestID string `json:"request_id,omitempty"`
+	}{status, http.StatusText(status), reqinfo.RequestID(r.Context())})
+}
+
+// wantsJSON 判断客户端是否偏好 JSON（Accept 包含 application/json 且不包含 text/html，如前端 fetch/XHR 调用）
+func wantsJSON(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "application/json") && !strings.Contains(accept, "text/html")
+}
+
+// Page 从文件加载的自定义页面
+type Page struct {
+	ContentType string
+	Body        []byte
+}
+
+// LoadPage 读取自定义页面文件，.json 文件按 JSON 返回，其他按 HTML 返回
+func LoadPage(path string) (*Page, error) {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取页面文件失败: %w", err)
+	}
+	contentType := "text/html; charset=utf-8"
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		contentType = "application/json; charset=utf-8"
+	}
+	return &Page{ContentType: contentType, Body: body}, nil
+}
+
+// ErrorPage 输出自定义错误页，page 为 nil 时输出默认错误页
+func (set *Set) ErrorPage(w http.ResponseWriter, r *http.Request, status int, page *Page) {
+	if page == nil {
+		set.Error(w, r, status)
+		return
+	}
+	w.Header().Set("Content-Type", page.ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write(page.Body)
+}
+
+// LoginUnavailable 输出登录服务不可用页面（CAS熔断期间），Retry-After 提示客户端稍后重试
+func (set *Set) LoginUnavailable(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	if wantsJSON(r) {
+		writeJSON(w, r, http.StatusServiceUnavailable)
+		return
+	}
+	set.Render(w, r, PageLoginUnavailable, http.StatusServiceUnavailable, Data{RetryAfter: seconds})
+}
+
+// Maintenance 输出维护页面（503），message 为空时使用内置文本
+func (set *Set) Maintenance(w http.ResponseWriter, r *http.Request, retryAfter time.Duration, message string) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	if wantsJSON(r) {
+		writeJSON(w, r, http.StatusServiceUnavailable)
+		return
+	}
+	set.Render(w, r, PageMaintenance, http.StatusServiceUnavailable, Data{RetryAfter: seconds, Message: message})
+}
+
+// Logout 输出已登出页面（CAS不可用、无法跳转CAS登出时），loginURL 为重新登录的地址
+func (set *Set) Logout(w http.ResponseWriter, r *http.Request, loginURL string) {
+	set.Render(w, r, PageLogout, http.StatusOK, Data{URL: loginURL})
+}
+
+// LogoutConfirm 输出登出确认页面，action 为确认后 POST 提交的地址；禁止嵌入框架，防止诱导点击
+func (set *Set) LogoutConfirm(w http.ResponseWriter, r *http.Request, action string) {
+	w.Header().Set("X-Frame-Options", "DENY")
+	set.Render(w, r, PageLogoutConfirm, http.StatusOK, Data{URL: action})
+}
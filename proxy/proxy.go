@@ -1,29 +1,122 @@
 ﻿package proxy
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"sync/atomic"
+	"time"
+	"cas-gateway/metrics"
 	"cas-gateway/models"
+	"cas-gateway/pages"
+	"cas-gateway/reqinfo"
+	"cas-gateway/tlsutil"
+	"cas-gateway/tracing"
 )
 
-// ProxyManager 代理管理器
+// 后端超时默认值
+const (
+	defaultDialTimeout           = 5 * time.Second
+	defaultTLSHandshakeTimeout   = 10 * time.Second
+	defaultResponseHeaderTimeout = 60 * time.Second
+)
+
+// ProxyManager 代理管理器，在后端池中轮询转发，幂等请求失败时换其他后端重试
 type ProxyManager struct {
-	proxy *httputil.ReverseProxy
-	route *models.RouteConfig
+	route      *models.RouteConfig
+	upstreams  []*upstream
+	next       atomic.Uint32
+	errorPages map[int]*pages.Page
+	pages      *pages.Set   // 网关生成的页面模板
+	handler    http.Handler // GetProxy 返回的处理器，可通过 Wrap 添加前置检查
+}
+
+// upstream 后端池成员
+type upstream struct {
+	target string
+	proxy  *httputil.ReverseProxy
+}
+
+// attemptKey 在请求上下文中传递本次转发是否还能重试
+type attemptKey struct{}
+
+type attempt struct {
+	canRetry bool
+	failed   bool
+}
+
+// NewProxyManager 创建代理管理器，pageSet 用于输出转发失败的错误页
+func NewProxyManager(route *models.RouteConfig, pageSet *pages.Set) (*ProxyManager, error) {
+	transport, err := newTransport(route)
+	if err != nil {
+		return nil, fmt.Errorf("后端TLS配置无效 [%s]: %w", route.Name, err)
+	}
+
+	pm := &ProxyManager{
+		route:      route,
+		errorPages: make(map[int]*pages.Page),
+		pages:      pageSet,
+	}
+	for status, path := range route.ErrorPages {
+		page, err := pages.LoadPage(path)
+		if err != nil {
+			return nil, fmt.Errorf("加载错误页失败 [%s] %d: %w", route.Name, status, err)
+		}
+		pm.errorPages[status] = page
+	}
+
+	for _, target := range route.AllTargets() {
+		targetURL, err := url.Parse(target)
+		if err != nil {
+			return nil, fmt.Errorf("解析目标URL失败 [%s]: %w", route.Name, err)
+		}
+		pm.upstreams = append(pm.upstreams, &upstream{
+			target: targetURL.String(),
+			proxy:  pm.newReverseProxy(targetURL, transport),
+		})
+	}
+	pm.handler = http.HandlerFunc(pm.ServeHTTP)
+	return pm, nil
 }
 
-// NewProxyManager 创建代理管理器
-func NewProxyManager(route *models.RouteConfig) (*ProxyManager, error) {
-	targetURL, err := url.Parse(route.Target)
+// newTransport 创建带超时和 TLS 配置的后端 Transport
+func newTransport(route *models.RouteConfig) (http.RoundTripper, error) {
+	tlsCfg, err := tlsutil.ClientConfig(&route.TLS)
 	if err != nil {
-		return nil, fmt.Errorf("解析目标URL失败 [%s]: %w", route.Name, err)
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   orDefault(route.DialTimeout, defaultDialTimeout),
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.TLSHandshakeTimeout = orDefault(route.TLSHandshakeTimeout, defaultTLSHandshakeTimeout)
+	transport.ResponseHeaderTimeout = orDefault(route.ResponseHeaderTimeout, defaultResponseHeaderTimeout)
+	if tlsCfg != nil {
+		transport.TLSClientConfig = tlsCfg
+	}
+	return &timingTransport{base: transport}, nil
+}
+
+func orDefault(d, def time.Duration) time.Duration {
+	if d <= 0 {
+		return def
 	}
+	return d
+}
 
+// newReverseProxy 创建转发到单个后端的反向代理
+func (pm *ProxyManager) newReverseProxy(targetURL *url.URL, transport http.RoundTripper) *httputil.ReverseProxy {
+	route := pm.route
 	proxy := httputil.NewSingleHostReverseProxy(targetURL)
-	
+	proxy.Transport = transport
+	proxy.FlushInterval = route.FlushInterval
+
 	// 自定义Director以修改请求
 	originalDirector := proxy.Director
 	target := targetURL.String()
@@ -31,21 +124,124 @@ func NewProxyManager(route *models.RouteConfig) (*ProxyManager, error) {
 		originalDirector(req)
 		// 可以在这里添加自定义的请求头等
 		req.Header.Set("X-Forwarded-By", "cas-gateway")
-		log.Printf("[代理] 转发请求: %s %s -> %s%s", req.Method, req.URL.Path, target, req.URL.Path)
+		// 告知后端客户端实际使用的协议和主机名（不可信来源的转发头已在入口删除）
+		if info := reqinfo.FromContext(req.Context()); info != nil && info.Scheme != "" {
+			req.Header.Set("X-Forwarded-Proto", info.Scheme)
+			req.Header.Set("X-Forwarded-Host", info.Host)
+		}
+		if id := reqinfo.RequestID(req.Context()); id != "" {
+			req.Header.Set(reqinfo.HeaderRequestID, id)
+		}
+		slog.DebugContext(req.Context(), "转发请求", "route", route.Name, "method", req.Method, "path", req.URL.Path, "upstream", target)
 	}
 
-	return &ProxyManager{
-		proxy: proxy,
-		route: route,
-	}, nil
+	// 转发失败：还能重试时交给 ServeHTTP 换后端，否则记录指标并返回错误页
+	proxy.ErrorHandler = func(w http.ResponseWriter, req *http.Request, err error) {
+		if errors.Is(err, context.Canceled) && req.Context().Err() != nil {
+			slog.DebugContext(req.Context(), "客户端已断开", "route", route.Name, "path", req.URL.Path, "upstream", target)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		metrics.UpstreamErrors.Inc(route.Name)
+		if a, ok := req.Context().Value(attemptKey{}).(*attempt); ok && a.canRetry {
+			a.failed = true
+			slog.WarnContext(req.Context(), "转发后端失败，重试其他后端", "route", route.Name, "method", req.Method, "path", req.URL.Path, "upstream", target, "error", err)
+			return
+		}
+		status := errorStatus(err)
+		slog.ErrorContext(req.Context(), "转发后端失败", "route", route.Name, "method", req.Method, "path", req.URL.Path, "upstream", target, "status", status, "error", err)
+		pm.pages.ErrorPage(w, req, status, pm.errorPages[status])
+	}
+	return proxy
+}
+
+// errorStatus 根据转发错误选择状态码：超时 504，无法连接 503，其他 502
+func errorStatus(err error) int {
+	var nerr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &nerr) && nerr.Timeout()) {
+		return http.StatusGatewayTimeout
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadGateway
+}
+
+// ServeHTTP 轮询选择后端转发，幂等且无请求体的请求失败时依次换其他后端重试
+func (pm *ProxyManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	attempts := 1
+	if retryable(r) {
+		attempts = min(1+pm.route.Retries, len(pm.upstreams))
+	}
+	start := int(pm.next.Add(1) - 1)
+	for i := 0; i < attempts; i++ {
+		u := pm.upstreams[(start+i)%len(pm.upstreams)]
+		a := &attempt{canRetry: i < attempts-1}
+		u.proxy.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), attemptKey{}, a)))
+		if !a.failed {
+			return
+		}
+	}
+}
+
+// retryable 幂等方法且没有请求体的请求才能安全地重发到其他后端
+func retryable(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return r.Body == nil || r.Body == http.NoBody
+	}
+	return false
+}
+
+// Wrap 在转发之前添加检查（如维护模式），需在处理请求前调用
+func (pm *ProxyManager) Wrap(mw func(http.Handler) http.Handler) {
+	pm.handler = mw(pm.handler)
 }
 
 // GetProxy 获取代理
-func (pm *ProxyManager) GetProxy() *httputil.ReverseProxy {
-	return pm.proxy
+func (pm *ProxyManager) GetProxy() http.Handler {
+	return pm.handler
 }
 
 // GetRoute 获取路由配置
 func (pm *ProxyManager) GetRoute() *models.RouteConfig {
 	return pm.route
 }
+
+// ErrorPage 返回 route.error_pages 中配置的错误页，未配置时返回 nil
+func (pm *ProxyManager) ErrorPage(status int) *pages.Page {
+	return pm.errorPages[status]
+}
+
+// timingTransport 记录后端地址和响应耗时（到收到响应头为止），供访问日志使用；
+// 同时创建后端请求的追踪 span 并向后端传播 traceparent
+type timingTransport struct {
+	base http.RoundTripper
+}
+
+func (t *timingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := tracing.Start(req.Context(), "proxy.upstream", tracing.SpanKindClient)
+	defer span.End()
+	if span != nil {
+		// RoundTripper 不应修改传入的请求，复制后再注入追踪头
+		req = req.Clone(ctx)
+		tracing.Inject(ctx, req.Header)
+		span.SetAttr("http.request.method", req.Method)
+		span.SetAttr("server.address", req.URL.Host)
+		span.SetAttr("url.path", req.URL.Path)
+	}
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	if info := reqinfo.FromContext(req.Context()); info != nil {
+		info.Upstream = req.URL.Host
+		info.UpstreamDuration = time.Since(start)
+	}
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	span.SetAttr("http.response.status_code", resp.StatusCode)
+	return resp, nil
+}
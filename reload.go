@@ -0,0 +1,136 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+	"cas-gateway/config"
+	"cas-gateway/metrics"
+	"cas-gateway/models"
+)
+
+// configWatchInterval 配置文件变更检查间隔
+const configWatchInterval = 5 * time.Second
+
+var configReloads = metrics.NewCounterVec("cas_gateway_config_reloads_total",
+	"Total number of configuration reload attempts.", "result")
+
+// reloader 持有当前的网关处理器，配置重载时原子替换；处理中的请求继续使用旧处理器直至完成
+type reloader struct {
+	path  string
+	build func(cfg *models.Config) (http.Handler, error)
+
+	mu      sync.Mutex // 串行化重载
+	cfg     *models.Config
+	modTime time.Time
+	size    int64
+
+	current atomic.Pointer[http.Handler]
+}
+
+// newReloader 创建配置重载器
+func newReloader(path string, cfg *models.Config, h http.Handler, build func(cfg *models.Config) (http.Handler, error)) *reloader {
+	rl := &reloader{path: path, build: build, cfg: cfg}
+	rl.current.Store(&h)
+	if info, err := os.Stat(path); err == nil {
+		rl.modTime, rl.size = info.ModTime(), info.Size()
+	}
+	return rl
+}
+
+func (rl *reloader) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	(*rl.current.Load()).ServeHTTP(w, r)
+}
+
+// Reload 重新加载并验证配置，成功后替换网关处理器；失败时保留旧配置
+func (rl *reloader) Reload() error {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if info, err := os.Stat(rl.path); err == nil {
+		rl.modTime, rl.size = info.ModTime(), info.Size()
+	}
+
+	cfg, err := config.LoadConfig(rl.path)
+	if err != nil {
+		configReloads.Inc("failure")
+		return err
+	}
+	h, err := rl.build(cfg)
+	if err != nil {
+		configReloads.Inc("failure")
+		return err
+	}
+
+	for _, section := range restartRequired(rl.cfg, cfg) {
+		slog.Warn("配置项不支持热加载，需重启后生效", "section", section)
+	}
+	rl.current.Store(&h)
+	rl.cfg = cfg
+	configReloads.Inc("success")
+	slog.Info("配置已重新加载", "route", cfg.Route.Name, "path", cfg.Route.Path, "upstream", cfg.Route.Target)
+	return nil
+}
+
+// Config 返回当前生效的配置
+func (rl *reloader) Config() *models.Config {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return rl.cfg
+}
+
+// Watch 定期检查配置文件的修改时间和大小，变化时自动重载，stop 关闭后退出
+func (rl *reloader) Watch(stop <-chan struct{}) {
+	ticker := time.NewTicker(configWatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(rl.path)
+		if err != nil {
+			continue
+		}
+		rl.mu.Lock()
+		changed := !info.ModTime().Equal(rl.modTime) || info.Size() != rl.size
+		rl.mu.Unlock()
+		if !changed {
+			continue
+		}
+		slog.Info("检测到配置文件变更，重新加载", "path", rl.path)
+		if err := rl.Reload(); err != nil {
+			slog.Error("配置重新加载失败，继续使用旧配置", "error", err)
+		}
+	}
+}
+
+// restartRequired 返回发生变化但只在启动时生效的配置项
+func restartRequired(old, cur *models.Config) []string {
+	var sections []string
+	check := func(name string, a, b any) {
+		if !reflect.DeepEqual(a, b) {
+			sections = append(sections, name)
+		}
+	}
+	check("server.port", old.Server.Port, cur.Server.Port)
+	check("server.trusted_proxies", old.Server.TrustedProxies, cur.Server.TrustedProxies)
+	check("server.pre_stop_delay", old.Server.PreStopDelay, cur.Server.PreStopDelay)
+	check("server.shutdown_timeout", old.Server.ShutdownTimeout, cur.Server.ShutdownTimeout)
+	check("server.watch_config", old.Server.WatchConfig, cur.Server.WatchConfig)
+	check("server.tls", old.Server.TLS, cur.Server.TLS)
+	check("server.proxy_protocol", old.Server.ProxyProtocol, cur.Server.ProxyProtocol)
+	check("metrics", old.Metrics, cur.Metrics)
+	check("log", old.Log, cur.Log)
+	check("access_log", old.AccessLog, cur.AccessLog)
+	check("audit", old.Audit, cur.Audit)
+	check("tracing", old.Tracing, cur.Tracing)
+	check("admin", old.Admin, cur.Admin)
+	return sections
+}
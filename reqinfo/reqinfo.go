@@ -0,0 +1,53 @@
+package reqinfo
+
+import (
+	"context"
+	"time"
+)
+
+type contextKey struct{}
+
+// Info 请求级上下文信息，由最外层中间件创建，认证、代理等环节逐步补充，供访问日志等使用
+// 同一请求的各环节在同一个 goroutine 中顺序执行，无需加锁
+type Info struct {
+	RequestID string    // 请求ID
+	TraceID   string    // 追踪ID（启用追踪时）
+	Start     time.Time // 请求开始时间
+	Route     string    // 路由名称
+	User      string    // 已认证用户（oaid）
+	Upstream  string    // 实际转发的后端地址
+
+	// 真实客户端信息，来自可信代理时按转发头解析，否则取直接连接的对端
+	ClientIP string // 客户端IP
+	Scheme   string // 客户端访问网关使用的协议（http/https）
+	Host     string // 客户端访问网关使用的主机名（可带端口）
+
+	// UpstreamDuration 后端响应耗时（从发出请求到收到响应头）
+	UpstreamDuration time.Duration
+}
+
+// NewContext 创建携带请求信息的 context
+func NewContext(ctx context.Context) (context.Context, *Info) {
+	info := &Info{Start: time.Now()}
+	return context.WithValue(ctx, contextKey{}, info), info
+}
+
+// FromContext 获取请求信息，未创建时返回 nil
+func FromContext(ctx context.Context) *Info {
+	info, _ := ctx.Value(contextKey{}).(*Info)
+	return info
+}
+
+// SetUser 记录已认证用户
+func SetUser(ctx context.Context, user string) {
+	if info := FromContext(ctx); info != nil {
+		info.User = user
+	}
+}
+
+// SetRoute 记录路由名称
+func SetRoute(ctx context.Context, route string) {
+	if info := FromContext(ctx); info != nil {
+		info.Route = route
+	}
+}
@@ -0,0 +1,46 @@
+package reqinfo
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// HeaderRequestID 请求ID头
+const HeaderRequestID = "X-Request-ID"
+
+// maxRequestIDLen 接受的外部请求ID最大长度
+const maxRequestIDLen = 128
+
+// NewRequestID 生成随机请求ID（32位十六进制）
+func NewRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic("reqinfo: 生成请求ID失败: " + err.Error())
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// ValidRequestID 校验外部传入的请求ID，只允许字母、数字和 -_.: 字符，避免日志注入
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// RequestID 获取请求ID，未创建时返回空
+func RequestID(ctx context.Context) string {
+	if info := FromContext(ctx); info != nil {
+		return info.RequestID
+	}
+	return ""
+}
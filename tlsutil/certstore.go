@@ -0,0 +1,136 @@
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"cas-gateway/models"
+)
+
+// CertStore 服务端证书集合，按 SNI 选择证书，并在证书文件变化时自动重新加载
+type CertStore struct {
+	pairs []models.CertificateConfig
+
+	mu       sync.RWMutex
+	certs    []*tls.Certificate
+	byName   map[string]*tls.Certificate
+	modTimes map[string]time.Time
+}
+
+// NewCertStore 加载证书，第一个证书为默认证书（客户端未发送 SNI 或没有匹配时使用）
+func NewCertStore(pairs []models.CertificateConfig) (*CertStore, error) {
+	if len(pairs) == 0 {
+		return nil, fmt.Errorf("未配置证书")
+	}
+	cs := &CertStore{pairs: pairs}
+	if err := cs.Reload(); err != nil {
+		return nil, err
+	}
+	return cs, nil
+}
+
+// Reload 重新加载所有证书，任一证书加载失败时保留旧证书
+func (cs *CertStore) Reload() error {
+	certs := make([]*tls.Certificate, 0, len(cs.pairs))
+	byName := make(map[string]*tls.Certificate)
+	modTimes := make(map[string]time.Time)
+
+	for _, p := range cs.pairs {
+		cert, err := tls.LoadX509KeyPair(p.CertFile, p.KeyFile)
+		if err != nil {
+			return fmt.Errorf("加载证书失败 [%s]: %w", p.CertFile, err)
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return fmt.Errorf("解析证书失败 [%s]: %w", p.CertFile, err)
+		}
+		cert.Leaf = leaf
+		certs = append(certs, &cert)
+
+		names := leaf.DNSNames
+		if len(names) == 0 && leaf.Subject.CommonName != "" {
+			names = []string{leaf.Subject.CommonName}
+		}
+		for _, name := range names {
+			name = strings.ToLower(name)
+			// 先配置的证书优先
+			if _, exists := byName[name]; !exists {
+				byName[name] = &cert
+			}
+		}
+		for _, f := range []string{p.CertFile, p.KeyFile} {
+			if info, err := os.Stat(f); err == nil {
+				modTimes[f] = info.ModTime()
+			}
+		}
+	}
+
+	cs.mu.Lock()
+	cs.certs, cs.byName, cs.modTimes = certs, byName, modTimes
+	cs.mu.Unlock()
+	return nil
+}
+
+// GetCertificate 供 tls.Config 使用：精确匹配 SNI，其次匹配通配符证书，否则返回默认证书
+func (cs *CertStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if name != "" {
+		if cert, ok := cs.byName[name]; ok {
+			return cert, nil
+		}
+		if i := strings.IndexByte(name, '.'); i > 0 {
+			if cert, ok := cs.byName["*"+name[i:]]; ok {
+				return cert, nil
+			}
+		}
+	}
+	return cs.certs[0], nil
+}
+
+// changed 判断证书文件是否有修改
+func (cs *CertStore) changed() bool {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	for _, p := range cs.pairs {
+		for _, f := range []string{p.CertFile, p.KeyFile} {
+			info, err := os.Stat(f)
+			if err != nil {
+				continue
+			}
+			if !info.ModTime().Equal(cs.modTimes[f]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Watch 定期检查证书文件，变化时重新加载（如 certbot 续期后），stop 关闭后退出
+func (cs *CertStore) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		if !cs.changed() {
+			continue
+		}
+		if err := cs.Reload(); err != nil {
+			// 续期时证书和私钥可能尚未全部写完，下一轮会重试
+			slog.Error("重新加载证书失败，继续使用旧证书", "error", err)
+			continue
+		}
+		slog.Info("证书已重新加载")
+	}
+}
@@ -0,0 +1,48 @@
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"cas-gateway/models"
+)
+
+// ClientConfig 根据配置创建访问后端或CAS服务器的 TLS 配置，未配置任何项时返回 nil（使用系统默认）
+func ClientConfig(cfg *models.ClientTLSConfig) (*tls.Config, error) {
+	if cfg == nil || *cfg == (models.ClientTLSConfig{}) {
+		return nil, nil
+	}
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return nil, fmt.Errorf("客户端证书的 cert_file 和 key_file 必须同时配置")
+	}
+
+	tlsCfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	// 自定义CA：只信任CA文件中的证书（内部CA签发的服务器证书）
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取CA证书失败: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA证书文件中没有有效的证书: %s", cfg.CAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	// 双向TLS客户端证书
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("加载客户端证书失败 [%s]: %w", cfg.CertFile, err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	return tlsCfg, nil
+}
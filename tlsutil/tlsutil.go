@@ -0,0 +1,75 @@
+package tlsutil
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+	"cas-gateway/models"
+)
+
+// ParseMinVersion 解析 TLS 最低版本，空字符串默认为 1.2
+func ParseMinVersion(s string) (uint16, error) {
+	switch s {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.0":
+		return tls.VersionTLS10, nil
+	}
+	return 0, fmt.Errorf("TLS 版本无效: %q（可选值 1.0、1.1、1.2、1.3）", s)
+}
+
+// ParseCipherSuites 按名称解析加密套件（如 TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256），只允许 Go 认为安全的套件
+// 列表为空时返回 nil，使用 Go 的默认套件；TLS 1.3 的套件不可配置
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	secure := make(map[string]uint16)
+	for _, cs := range tls.CipherSuites() {
+		secure[cs.Name] = cs.ID
+	}
+	insecure := make(map[string]bool)
+	for _, cs := range tls.InsecureCipherSuites() {
+		insecure[cs.Name] = true
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		id, ok := secure[name]
+		if !ok {
+			if insecure[name] {
+				return nil, fmt.Errorf("加密套件不安全: %s", name)
+			}
+			return nil, fmt.Errorf("加密套件无效: %s", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// ServerConfig 根据配置创建服务端 TLS 配置和证书集合
+func ServerConfig(cfg *models.TLSConfig) (*tls.Config, *CertStore, error) {
+	minVersion, err := ParseMinVersion(cfg.MinVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+	suites, err := ParseCipherSuites(cfg.CipherSuites)
+	if err != nil {
+		return nil, nil, err
+	}
+	store, err := NewCertStore(cfg.AllCertificates())
+	if err != nil {
+		return nil, nil, err
+	}
+	return &tls.Config{
+		MinVersion:     minVersion,
+		CipherSuites:   suites,
+		GetCertificate: store.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}, store, nil
+}
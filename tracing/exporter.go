@@ -0,0 +1,227 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"cas-gateway/models"
+)
+
+// 导出器类型
+const (
+	ExporterOTLPHTTP = "otlp-http"
+	ExporterOTLPGRPC = "otlp-grpc"
+	ExporterStdout   = "stdout"
+	ExporterFile     = "file"
+)
+
+// NewExporter 根据配置创建导出器
+func NewExporter(cfg models.TracingConfig) (Exporter, error) {
+	switch cfg.Exporter {
+	case ExporterOTLPHTTP:
+		return newOTLPHTTPExporter(cfg), nil
+	case ExporterStdout:
+		return &writerExporter{w: os.Stdout, serviceName: cfg.ServiceName}, nil
+	case ExporterFile:
+		f, err := os.OpenFile(cfg.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("打开追踪输出文件失败: %w", err)
+		}
+		return &writerExporter{w: f, closer: f, serviceName: cfg.ServiceName}, nil
+	case ExporterOTLPGRPC:
+		return newOTLPGRPCExporter(cfg)
+	}
+	return nil, fmt.Errorf("追踪导出器无效: %q（可选值 otlp-http、otlp-grpc、stdout、file）", cfg.Exporter)
+}
+
+// writerExporter 每批 span 输出为一行 OTLP JSON（ExportTraceServiceRequest），便于离线查看或导入
+type writerExporter struct {
+	mu          sync.Mutex
+	w           io.Writer
+	closer      io.Closer
+	serviceName string
+}
+
+func (e *writerExporter) Export(ctx context.Context, spans []SpanData) error {
+	data, err := json.Marshal(buildOTLPRequest(e.serviceName, spans))
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err = e.w.Write(append(data, '\n'))
+	return err
+}
+
+func (e *writerExporter) Shutdown(ctx context.Context) error {
+	if e.closer != nil {
+		return e.closer.Close()
+	}
+	return nil
+}
+
+// otlpHTTPExporter OTLP/HTTP 导出器，使用 JSON 编码（Content-Type: application/json）
+type otlpHTTPExporter struct {
+	url         string
+	headers     map[string]string
+	serviceName string
+	client      *http.Client
+}
+
+func newOTLPHTTPExporter(cfg models.TracingConfig) *otlpHTTPExporter {
+	endpoint := strings.TrimSuffix(cfg.Endpoint, "/")
+	if !strings.HasSuffix(endpoint, "/v1/traces") {
+		endpoint += "/v1/traces"
+	}
+	return &otlpHTTPExporter{
+		url:         endpoint,
+		headers:     cfg.Headers,
+		serviceName: cfg.ServiceName,
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (e *otlpHTTPExporter) Export(ctx context.Context, spans []SpanData) error {
+	body, err := json.Marshal(buildOTLPRequest(e.serviceName, spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("OTLP 接收端返回 %s", resp.Status)
+	}
+	return nil
+}
+
+func (e *otlpHTTPExporter) Shutdown(ctx context.Context) error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+// 以下为 OTLP JSON 编码结构（opentelemetry-proto，trace/span ID 为十六进制字符串）
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	TraceState        string         `json:"traceState,omitempty"`
+	Name              string         `json:"name"`
+	Kind              SpanKind       `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"` // 0 UNSET，2 ERROR
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+func buildOTLPRequest(serviceName string, spans []SpanData) otlpRequest {
+	out := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		span := otlpSpan{
+			TraceID:           s.Context.TraceID.String(),
+			SpanID:            s.Context.SpanID.String(),
+			TraceState:        s.Context.TraceState,
+			Name:              s.Name,
+			Kind:              s.Kind,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.Attributes),
+		}
+		if s.Parent.IsValid() {
+			span.ParentSpanID = s.Parent.String()
+		}
+		if s.Error {
+			span.Status = otlpStatus{Code: 2, Message: s.ErrorMsg}
+		}
+		out = append(out, span)
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: otlpAttributes(map[string]any{"service.name": serviceName})},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "cas-gateway"},
+			Spans: out,
+		}},
+	}}}
+}
+
+// otlpAttributes 按键排序转换属性，整数按 OTLP JSON 约定编码为字符串
+func otlpAttributes(attrs map[string]any) []otlpKeyValue {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	kvs := make([]otlpKeyValue, 0, len(keys))
+	for _, k := range keys {
+		var v map[string]any
+		switch val := attrs[k].(type) {
+		case string:
+			v = map[string]any{"stringValue": val}
+		case bool:
+			v = map[string]any{"boolValue": val}
+		case int:
+			v = map[string]any{"intValue": strconv.Itoa(val)}
+		case int64:
+			v = map[string]any{"intValue": strconv.FormatInt(val, 10)}
+		case float64:
+			v = map[string]any{"doubleValue": val}
+		default:
+			v = map[string]any{"stringValue": fmt.Sprint(val)}
+		}
+		kvs = append(kvs, otlpKeyValue{Key: k, Value: v})
+	}
+	return kvs
+}
@@ -0,0 +1,216 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"cas-gateway/models"
+
+	"golang.org/x/net/http2"
+)
+
+// otlpGRPCMethod OTLP 追踪导出的 gRPC 方法路径
+const otlpGRPCMethod = "/opentelemetry.proto.collector.trace.v1.TraceService/Export"
+
+// otlpGRPCExporter OTLP/gRPC 导出器，使用 x/net/http2 发送 gRPC 请求（protobuf 编码），不引入 grpc 依赖
+// endpoint 为 http:// 时使用明文 HTTP/2（h2c），https:// 时使用 TLS
+type otlpGRPCExporter struct {
+	url         string
+	headers     map[string]string
+	serviceName string
+	client      *http.Client
+	transport   *http2.Transport
+}
+
+func newOTLPGRPCExporter(cfg models.TracingConfig) (*otlpGRPCExporter, error) {
+	endpoint := cfg.Endpoint
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "http://" + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("otlp-grpc endpoint 无效: %q", cfg.Endpoint)
+	}
+
+	// 只使用 HTTP/2（gRPC 不支持 HTTP/1.1）：https 通过 TLS 连接，http 直接建立 TCP 连接使用 h2c
+	transport := &http2.Transport{IdleConnTimeout: 90 * time.Second}
+	if u.Scheme == "http" {
+		transport.AllowHTTP = true
+		transport.DialTLSContext = func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		}
+	}
+	return &otlpGRPCExporter{
+		url:         u.Scheme + "://" + u.Host + otlpGRPCMethod,
+		headers:     cfg.Headers,
+		serviceName: cfg.ServiceName,
+		client:      &http.Client{Transport: transport, Timeout: 10 * time.Second},
+		transport:   transport,
+	}, nil
+}
+
+func (e *otlpGRPCExporter) Export(ctx context.Context, spans []SpanData) error {
+	payload := encodeTraceRequest(e.serviceName, spans)
+
+	// gRPC 消息帧：1 字节压缩标记 + 4 字节长度（大端）+ 消息
+	body := make([]byte, 5+len(payload))
+	binary.BigEndian.PutUint32(body[1:5], uint32(len(payload)))
+	copy(body[5:], payload)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	for k, v := range e.headers {
+		// gRPC metadata 键为小写
+		req.Header.Set(strings.ToLower(k), v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// 读完响应体后才能取到 trailer 中的 grpc-status
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("OTLP gRPC 接收端返回 %s", resp.Status)
+	}
+	return grpcStatusError(resp)
+}
+
+func (e *otlpGRPCExporter) Shutdown(ctx context.Context) error {
+	e.transport.CloseIdleConnections()
+	return nil
+}
+
+// grpcStatusError 检查 grpc-status（正常响应在 trailer 中，只有头部的错误响应在 header 中）
+func grpcStatusError(resp *http.Response) error {
+	status, message := resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status, message = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+	switch status {
+	case "0":
+		return nil
+	case "":
+		return fmt.Errorf("OTLP gRPC 响应缺少 grpc-status")
+	}
+	if m, err := url.PathUnescape(message); err == nil {
+		message = m
+	}
+	return fmt.Errorf("OTLP gRPC 接收端返回 grpc-status %s: %s", status, message)
+}
+
+// 以下为 ExportTraceServiceRequest 的 protobuf 编码（opentelemetry-proto，字段号见各函数注释）
+
+// encodeTraceRequest ExportTraceServiceRequest{resource_spans=1}，
+// ResourceSpans{resource=1, scope_spans=2}，Resource{attributes=1}，ScopeSpans{scope=1, spans=2}，InstrumentationScope{name=1}
+func encodeTraceRequest(serviceName string, spans []SpanData) []byte {
+	resource := pbKeyValues(nil, 1, map[string]any{"service.name": serviceName})
+	scope := pbString(nil, 1, "cas-gateway")
+
+	scopeSpans := pbBytes(nil, 1, scope)
+	for _, s := range spans {
+		scopeSpans = pbBytes(scopeSpans, 2, encodeSpan(s))
+	}
+
+	resourceSpans := pbBytes(nil, 1, resource)
+	resourceSpans = pbBytes(resourceSpans, 2, scopeSpans)
+	return pbBytes(nil, 1, resourceSpans)
+}
+
+// encodeSpan Span{trace_id=1, span_id=2, trace_state=3, parent_span_id=4, name=5, kind=6,
+// start_time_unix_nano=7, end_time_unix_nano=8, attributes=9, status=15}，Status{message=2, code=3}
+func encodeSpan(s SpanData) []byte {
+	b := pbBytes(nil, 1, s.Context.TraceID[:])
+	b = pbBytes(b, 2, s.Context.SpanID[:])
+	if s.Context.TraceState != "" {
+		b = pbString(b, 3, s.Context.TraceState)
+	}
+	if s.Parent.IsValid() {
+		b = pbBytes(b, 4, s.Parent[:])
+	}
+	b = pbString(b, 5, s.Name)
+	b = pbVarint(b, 6, uint64(s.Kind))
+	b = pbFixed64(b, 7, uint64(s.Start.UnixNano()))
+	b = pbFixed64(b, 8, uint64(s.End.UnixNano()))
+	b = pbKeyValues(b, 9, s.Attributes)
+	if s.Error {
+		status := pbString(nil, 2, s.ErrorMsg)
+		status = pbVarint(status, 3, 2) // STATUS_CODE_ERROR
+		b = pbBytes(b, 15, status)
+	}
+	return b
+}
+
+// pbKeyValues 按键排序编码属性：KeyValue{key=1, value=2}，
+// AnyValue{string_value=1, bool_value=2, int_value=3, double_value=4}
+func pbKeyValues(b []byte, field int, attrs map[string]any) []byte {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		var value []byte
+		switch val := attrs[k].(type) {
+		case string:
+			value = pbString(nil, 1, val)
+		case bool:
+			v := uint64(0)
+			if val {
+				v = 1
+			}
+			value = pbVarint(nil, 2, v)
+		case int:
+			value = pbVarint(nil, 3, uint64(int64(val)))
+		case int64:
+			value = pbVarint(nil, 3, uint64(val))
+		case float64:
+			value = pbTag(nil, 4, 1)
+			value = binary.LittleEndian.AppendUint64(value, math.Float64bits(val))
+		default:
+			value = pbString(nil, 1, fmt.Sprint(val))
+		}
+		kv := pbString(nil, 1, k)
+		kv = pbBytes(kv, 2, value)
+		b = pbBytes(b, field, kv)
+	}
+	return b
+}
+
+// pbTag 写入字段标签，wireType：0 varint，1 64位，2 长度前缀
+func pbTag(b []byte, field, wireType int) []byte {
+	return binary.AppendUvarint(b, uint64(field)<<3|uint64(wireType))
+}
+
+func pbVarint(b []byte, field int, v uint64) []byte {
+	return binary.AppendUvarint(pbTag(b, field, 0), v)
+}
+
+func pbFixed64(b []byte, field int, v uint64) []byte {
+	return binary.LittleEndian.AppendUint64(pbTag(b, field, 1), v)
+}
+
+func pbBytes(b []byte, field int, v []byte) []byte {
+	b = binary.AppendUvarint(pbTag(b, field, 2), uint64(len(v)))
+	return append(b, v...)
+}
+
+func pbString(b []byte, field int, v string) []byte {
+	b = binary.AppendUvarint(pbTag(b, field, 2), uint64(len(v)))
+	return append(b, v...)
+}
@@ -0,0 +1,277 @@
+package tracing
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"cas-gateway/models"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func TestProtobufPrimitives(t *testing.T) {
+	tests := []struct {
+		name string
+		got  []byte
+		want string
+	}{
+		// protobuf 编码文档中的示例
+		{"varint", pbVarint(nil, 1, 150), "089601"},
+		{"string", pbString(nil, 2, "testing"), "120774657374696e67"},
+		{"bytes", pbBytes(nil, 15, []byte{1}), "7a0101"},
+		{"fixed64", pbFixed64(nil, 7, 1), "390100000000000000"},
+		{"两字节标签", pbVarint(nil, 16, 1), "800101"},
+		{"追加", pbVarint(pbVarint(nil, 1, 1), 2, 0), "08011000"},
+	}
+	for _, tt := range tests {
+		if got := hex.EncodeToString(tt.got); got != tt.want {
+			t.Errorf("%s: 编码 = %s，期望 %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestProtobufKeyValues(t *testing.T) {
+	tests := []struct {
+		name  string
+		attrs map[string]any
+		want  string
+	}{
+		{"string", map[string]any{"b": "x"}, "4a08" + "0a0162" + "12030a0178"},
+		{"bool", map[string]any{"a": true}, "4a07" + "0a0161" + "12021001"},
+		{"int", map[string]any{"n": 200}, "4a08" + "0a016e" + "120318c801"},
+		{"负数int64", map[string]any{"n": int64(-1)}, "4a10" + "0a016e" + "120b18ffffffffffffffffff01"},
+		{"float64", map[string]any{"c": 1.0}, "4a0e" + "0a0163" + "1209210000000000" + "00f03f"},
+		{"其他类型转为字符串", map[string]any{"d": time.Second}, "4a09" + "0a0164" + "12040a023173"},
+		{"按键排序", map[string]any{"b": "x", "a": true}, "4a07" + "0a0161" + "12021001" + "4a08" + "0a0162" + "12030a0178"},
+	}
+	for _, tt := range tests {
+		if got := hex.EncodeToString(pbKeyValues(nil, 9, tt.attrs)); got != tt.want {
+			t.Errorf("%s: 编码 = %s，期望 %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+// pbField 解码出的 protobuf 字段
+type pbField struct {
+	num   int
+	wire  int
+	value uint64 // varint 和 fixed64
+	bytes []byte // 长度前缀
+}
+
+// pbDecode 按 protobuf 线格式解码一层消息，作为编码器的参考实现
+func pbDecode(t *testing.T, b []byte) []pbField {
+	t.Helper()
+	var fields []pbField
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			t.Fatalf("标签解码失败: %x", b)
+		}
+		b = b[n:]
+		f := pbField{num: int(tag >> 3), wire: int(tag & 7)}
+		switch f.wire {
+		case 0:
+			f.value, n = binary.Uvarint(b)
+			if n <= 0 {
+				t.Fatalf("字段 %d varint 解码失败", f.num)
+			}
+			b = b[n:]
+		case 1:
+			if len(b) < 8 {
+				t.Fatalf("字段 %d fixed64 长度不足", f.num)
+			}
+			f.value = binary.LittleEndian.Uint64(b)
+			b = b[8:]
+		case 2:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				t.Fatalf("字段 %d 长度前缀无效", f.num)
+			}
+			f.bytes = b[n : n+int(l)]
+			b = b[n+int(l):]
+		default:
+			t.Fatalf("字段 %d 线格式 %d 不支持", f.num, f.wire)
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// pbOnly 返回唯一的指定字段
+func pbOnly(t *testing.T, fields []pbField, num int) pbField {
+	t.Helper()
+	var found []pbField
+	for _, f := range fields {
+		if f.num == num {
+			found = append(found, f)
+		}
+	}
+	if len(found) != 1 {
+		t.Fatalf("字段 %d 出现 %d 次，期望 1 次", num, len(found))
+	}
+	return found[0]
+}
+
+func testSpan() SpanData {
+	s := SpanData{
+		Name:       "GET /app",
+		Kind:       SpanKindServer,
+		Parent:     SpanID{9, 9, 9, 9, 9, 9, 9, 9},
+		Start:      time.Unix(1, 500),
+		End:        time.Unix(2, 0),
+		Attributes: map[string]any{"http.status_code": 502},
+		Error:      true,
+		ErrorMsg:   "upstream",
+	}
+	for i := range s.Context.TraceID {
+		s.Context.TraceID[i] = byte(i + 1)
+	}
+	for i := range s.Context.SpanID {
+		s.Context.SpanID[i] = byte(0xa0 + i)
+	}
+	s.Context.TraceState = "k=v"
+	return s
+}
+
+func TestEncodeSpan(t *testing.T) {
+	s := testSpan()
+	fields := pbDecode(t, encodeSpan(s))
+
+	if got := pbOnly(t, fields, 1).bytes; string(got) != string(s.Context.TraceID[:]) {
+		t.Errorf("trace_id = %x", got)
+	}
+	if got := pbOnly(t, fields, 2).bytes; string(got) != string(s.Context.SpanID[:]) {
+		t.Errorf("span_id = %x", got)
+	}
+	if got := string(pbOnly(t, fields, 3).bytes); got != "k=v" {
+		t.Errorf("trace_state = %q", got)
+	}
+	if got := pbOnly(t, fields, 4).bytes; string(got) != string(s.Parent[:]) {
+		t.Errorf("parent_span_id = %x", got)
+	}
+	if got := string(pbOnly(t, fields, 5).bytes); got != "GET /app" {
+		t.Errorf("name = %q", got)
+	}
+	if f := pbOnly(t, fields, 6); f.wire != 0 || f.value != 2 {
+		t.Errorf("kind = %+v，期望 varint 2", f)
+	}
+	if f := pbOnly(t, fields, 7); f.wire != 1 || f.value != 1000000500 {
+		t.Errorf("start_time_unix_nano = %+v", f)
+	}
+	if f := pbOnly(t, fields, 8); f.wire != 1 || f.value != 2000000000 {
+		t.Errorf("end_time_unix_nano = %+v", f)
+	}
+
+	kv := pbDecode(t, pbOnly(t, fields, 9).bytes)
+	if got := string(pbOnly(t, kv, 1).bytes); got != "http.status_code" {
+		t.Errorf("attribute key = %q", got)
+	}
+	if f := pbOnly(t, pbDecode(t, pbOnly(t, kv, 2).bytes), 3); f.value != 502 {
+		t.Errorf("attribute int_value = %d", f.value)
+	}
+
+	status := pbDecode(t, pbOnly(t, fields, 15).bytes)
+	if got := string(pbOnly(t, status, 2).bytes); got != "upstream" {
+		t.Errorf("status.message = %q", got)
+	}
+	if f := pbOnly(t, status, 3); f.value != 2 {
+		t.Errorf("status.code = %d，期望 2（ERROR）", f.value)
+	}
+}
+
+func TestEncodeSpanOmitsOptionalFields(t *testing.T) {
+	s := testSpan()
+	s.Context.TraceState = ""
+	s.Parent = SpanID{}
+	s.Attributes = nil
+	s.Error = false
+	for _, f := range pbDecode(t, encodeSpan(s)) {
+		switch f.num {
+		case 3, 4, 9, 15:
+			t.Errorf("字段 %d 不应编码", f.num)
+		}
+	}
+}
+
+// decodeTraceRequest 解码 ExportTraceServiceRequest，返回 service.name、scope 名称和 span 数量
+func decodeTraceRequest(t *testing.T, b []byte) (service, scope string, spans int) {
+	t.Helper()
+	resourceSpans := pbDecode(t, pbOnly(t, pbDecode(t, b), 1).bytes)
+	resource := pbDecode(t, pbOnly(t, resourceSpans, 1).bytes)
+	kv := pbDecode(t, pbOnly(t, resource, 1).bytes)
+	if key := string(pbOnly(t, kv, 1).bytes); key != "service.name" {
+		t.Fatalf("resource 属性 = %q", key)
+	}
+	service = string(pbOnly(t, pbDecode(t, pbOnly(t, kv, 2).bytes), 1).bytes)
+
+	scopeSpans := pbDecode(t, pbOnly(t, resourceSpans, 2).bytes)
+	scope = string(pbOnly(t, pbDecode(t, pbOnly(t, scopeSpans, 1).bytes), 1).bytes)
+	for _, f := range scopeSpans {
+		if f.num == 2 {
+			spans++
+		}
+	}
+	return service, scope, spans
+}
+
+func TestOTLPGRPCExportOverH2C(t *testing.T) {
+	received := make(chan []byte, 1)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 || r.URL.Path != otlpGRPCMethod || r.Header.Get("Content-Type") != "application/grpc" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		received <- body
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.Header().Set("Content-Type", "application/grpc")
+		w.WriteHeader(http.StatusOK)
+		w.Header().Set("Grpc-Status", "0")
+	})
+	srv := httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+	defer srv.Close()
+
+	exp, err := newOTLPGRPCExporter(models.TracingConfig{Endpoint: srv.Listener.Addr().String(), ServiceName: "gw"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exp.Shutdown(context.Background())
+	if err := exp.Export(context.Background(), []SpanData{testSpan(), testSpan()}); err != nil {
+		t.Fatalf("导出失败: %v", err)
+	}
+
+	body := <-received
+	if len(body) < 5 || body[0] != 0 || int(binary.BigEndian.Uint32(body[1:5])) != len(body)-5 {
+		t.Fatalf("gRPC 消息帧无效: %x", body[:min(len(body), 5)])
+	}
+	service, scope, spans := decodeTraceRequest(t, body[5:])
+	if service != "gw" || scope != "cas-gateway" || spans != 2 {
+		t.Fatalf("service=%q scope=%q spans=%d", service, scope, spans)
+	}
+}
+
+func TestOTLPGRPCStatusError(t *testing.T) {
+	srv := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Grpc-Status", "16")
+		w.Header().Set("Grpc-Message", "bad%20token")
+	}), &http2.Server{}))
+	defer srv.Close()
+
+	exp, err := newOTLPGRPCExporter(models.TracingConfig{Endpoint: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exp.Shutdown(context.Background())
+	err = exp.Export(context.Background(), []SpanData{testSpan()})
+	if err == nil || err.Error() != "OTLP gRPC 接收端返回 grpc-status 16: bad token" {
+		t.Fatalf("错误 = %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// W3C Trace Context 请求头
+const (
+	HeaderTraceparent = "traceparent"
+	HeaderTracestate  = "tracestate"
+)
+
+// TraceID 16字节追踪ID
+type TraceID [16]byte
+
+// SpanID 8字节span ID
+type SpanID [8]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+
+// IsValid 全零ID无效
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+func (s SpanID) IsValid() bool  { return s != SpanID{} }
+
+// SpanContext 跨进程传递的追踪上下文
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Sampled    bool
+	TraceState string
+}
+
+// IsValid 判断追踪上下文是否有效
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Traceparent 编码为 traceparent 头：00-{trace-id}-{parent-id}-{flags}
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+// ParseTraceparent 解析 traceparent 头，格式不合法时返回 false
+func ParseTraceparent(s string) (SpanContext, bool) {
+	var sc SpanContext
+	s = strings.TrimSpace(s)
+	// 十六进制必须为小写
+	if strings.ToLower(s) != s {
+		return sc, false
+	}
+	parts := strings.Split(s, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, false
+	}
+	// 版本 00 必须恰好4段，未来版本允许附加字段
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, false
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, false
+	}
+	var flags [1]byte
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return sc, false
+	}
+	sc.Sampled = flags[0]&0x01 == 1
+	return sc, sc.IsValid()
+}
+
+type remoteKey struct{}
+
+// Extract 从请求头中提取上游传入的追踪上下文，作为后续 span 的父级
+func Extract(ctx context.Context, h http.Header) context.Context {
+	sc, ok := ParseTraceparent(h.Get(HeaderTraceparent))
+	if !ok {
+		return ctx
+	}
+	sc.TraceState = h.Get(HeaderTracestate)
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// Inject 将当前 span 的追踪上下文写入请求头，未启用追踪时不修改
+func Inject(ctx context.Context, h http.Header) {
+	span := SpanFromContext(ctx)
+	if span == nil {
+		return
+	}
+	h.Set(HeaderTraceparent, span.sc.Traceparent())
+	if span.sc.TraceState != "" {
+		h.Set(HeaderTracestate, span.sc.TraceState)
+	} else {
+		h.Del(HeaderTracestate)
+	}
+}
+
+func newTraceID() TraceID {
+	var t TraceID
+	rand.Read(t[:])
+	return t
+}
+
+func newSpanID() SpanID {
+	var s SpanID
+	rand.Read(s[:])
+	return s
+}
@@ -0,0 +1,264 @@
+package tracing
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+	"cas-gateway/models"
+)
+
+// SpanKind span 类型（取值与 OTLP 一致）
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+const (
+	batchSize     = 512
+	queueSize     = 4096
+	flushInterval = 5 * time.Second
+)
+
+// Span 一个追踪片段；nil 表示未启用追踪，所有方法均可安全调用
+type Span struct {
+	tracer *Tracer
+	sc     SpanContext
+	parent SpanID
+
+	name  string
+	kind  SpanKind
+	start time.Time
+
+	mu       sync.Mutex
+	end      time.Time
+	attrs    map[string]any
+	errMsg   string
+	hasError bool
+	ended    bool
+}
+
+// SpanData 结束后交给导出器的 span 数据
+type SpanData struct {
+	Name       string
+	Kind       SpanKind
+	Context    SpanContext
+	Parent     SpanID
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]any
+	Error      bool
+	ErrorMsg   string
+}
+
+// Exporter span 导出器
+type Exporter interface {
+	Export(ctx context.Context, spans []SpanData) error
+	Shutdown(ctx context.Context) error
+}
+
+// Tracer 追踪器，span 结束后异步批量导出
+type Tracer struct {
+	exporter    Exporter
+	serviceName string
+	sampleRatio float64
+
+	queue chan SpanData
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+var global atomic.Pointer[Tracer]
+
+// Setup 根据配置初始化全局追踪器，返回的函数用于退出前刷新并关闭导出器
+func Setup(cfg models.TracingConfig) (func(context.Context) error, error) {
+	exporter, err := NewExporter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	t := &Tracer{
+		exporter:    exporter,
+		serviceName: cfg.ServiceName,
+		sampleRatio: cfg.SampleRatio,
+		queue:       make(chan SpanData, queueSize),
+		done:        make(chan struct{}),
+	}
+	t.wg.Add(1)
+	go t.run()
+	global.Store(t)
+	return t.Shutdown, nil
+}
+
+// Start 创建子 span；父级依次取 context 中的 span 和上游传入的追踪上下文，都没有时开始新的追踪
+func Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	t := global.Load()
+	if t == nil {
+		return ctx, nil
+	}
+
+	span := &Span{tracer: t, name: name, kind: kind, start: time.Now()}
+	if parent := SpanFromContext(ctx); parent != nil {
+		span.sc = parent.sc
+		span.parent = parent.sc.SpanID
+	} else if remote, ok := ctx.Value(remoteKey{}).(SpanContext); ok {
+		span.sc = remote
+		span.parent = remote.SpanID
+	} else {
+		span.sc.TraceID = newTraceID()
+		span.sc.Sampled = t.shouldSample(span.sc.TraceID)
+	}
+	span.sc.SpanID = newSpanID()
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+type spanKey struct{}
+
+// SpanFromContext 获取当前 span
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// TraceIDFromContext 获取当前追踪ID，未启用时返回空
+func TraceIDFromContext(ctx context.Context) string {
+	if span := SpanFromContext(ctx); span != nil {
+		return span.sc.TraceID.String()
+	}
+	return ""
+}
+
+// shouldSample 按追踪ID做比例采样，同一追踪在各服务间结果一致
+func (t *Tracer) shouldSample(id TraceID) bool {
+	if t.sampleRatio >= 1 {
+		return true
+	}
+	if t.sampleRatio <= 0 {
+		return false
+	}
+	v := binary.BigEndian.Uint64(id[8:]) >> 1
+	return float64(v) < t.sampleRatio*float64(uint64(1)<<63)
+}
+
+// SetAttr 设置属性
+func (s *Span) SetAttr(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.attrs == nil {
+		s.attrs = make(map[string]any)
+	}
+	s.attrs[key] = value
+	s.mu.Unlock()
+}
+
+// SetError 标记 span 失败
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.hasError = true
+	s.errMsg = err.Error()
+	s.mu.Unlock()
+}
+
+// End 结束 span，采样的 span 进入导出队列；队列满时丢弃
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	data := SpanData{
+		Name:       s.name,
+		Kind:       s.kind,
+		Context:    s.sc,
+		Parent:     s.parent,
+		Start:      s.start,
+		End:        s.end,
+		Attributes: s.attrs,
+		Error:      s.hasError,
+		ErrorMsg:   s.errMsg,
+	}
+	s.mu.Unlock()
+
+	if !s.sc.Sampled {
+		return
+	}
+	select {
+	case s.tracer.queue <- data:
+	default:
+	}
+}
+
+// run 批量导出循环
+func (t *Tracer) run() {
+	defer t.wg.Done()
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]SpanData, 0, batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := t.exporter.Export(ctx, batch); err != nil {
+			slog.Warn("导出追踪数据失败", "spans", len(batch), "error", err)
+		}
+		cancel()
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case data := <-t.queue:
+			batch = append(batch, data)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-t.done:
+			for {
+				select {
+				case data := <-t.queue:
+					batch = append(batch, data)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// Shutdown 导出剩余 span 并关闭导出器
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	global.CompareAndSwap(t, nil)
+	close(t.done)
+
+	finished := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		return fmt.Errorf("关闭追踪器超时: %w", ctx.Err())
+	}
+	return t.exporter.Shutdown(ctx)
+}